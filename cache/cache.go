@@ -6,10 +6,12 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 
 	"github.com/cloudlinker/kubecarve/cache/internal"
+	"github.com/cloudlinker/kubecarve/client"
 	"github.com/cloudlinker/kubecarve/client/apiutil"
 )
 
@@ -18,9 +20,53 @@ type Options struct {
 	Mapper    meta.RESTMapper
 	Resync    *time.Duration
 	Namespace string
+	// UnsafeDisableDeepCopy lists the kinds whose reads return the cached
+	// objects, which must never be modified
+	UnsafeDisableDeepCopy []schema.GroupVersionKind
+	// SyncTimeout bounds the wait for a new informer to sync, 2 minutes
+	// by default
+	SyncTimeout time.Duration
+	// WatchErrorHandler is called whenever listing or watching a kind fails
+	WatchErrorHandler WatchErrorHandler
+	// ReadThrough reads from the API server what the informers can't serve
+	// yet
+	ReadThrough bool
+	// SnapshotPath is the file to save the informer stores to on stop and
+	// to warm start them from
+	SnapshotPath string
+	// WaitForCRD makes the informers of unknown kinds wait for their CRD
+	WaitForCRD bool
+	// ListOrder orders the items of List, by namespace/name if it's nil
+	ListOrder LessFunc
+	// TombstoneTTL is how long deleted objects of each kind are kept for
+	// GetDeleted
+	TombstoneTTL map[schema.GroupVersionKind]time.Duration
 }
 
-var defaultResyncTime = 10 * time.Hour
+// LessFunc reports whether a should be listed before b
+type LessFunc = internal.LessFunc
+
+// WatchErrorHandler is called with the kind and the error of a failed
+// list or watch, or of an error event like an expired resource version.
+// The informer keeps retrying, remove it from the cache in the handler to
+// give up.
+type WatchErrorHandler = internal.WatchErrorHandler
+
+// InformerStatus reports the sync state, the last list or watch error, the
+// last synced resource version and the object count of one informer
+type InformerStatus = internal.InformerStatus
+
+// ErrCacheNotStarted is returned by Get and List before the cache is started
+type ErrCacheNotStarted = internal.ErrCacheNotStarted
+
+// ErrTimeout is returned by Get, List and GetInformer when the informer of
+// the kind doesn't sync before the deadline
+type ErrTimeout = internal.ErrTimeout
+
+var (
+	defaultResyncTime  = 10 * time.Hour
+	defaultSyncTimeout = 2 * time.Minute
+)
 
 func New(config *rest.Config, opts Options) (Cache, error) {
 	opts, err := defaultOpts(config, opts)
@@ -28,7 +74,31 @@ func New(config *rest.Config, opts Options) (Cache, error) {
 		return nil, err
 	}
 	im := internal.NewInformersMap(config, opts.Scheme, opts.Mapper, *opts.Resync, opts.Namespace)
-	return &informerCache{InformersMap: im}, nil
+	im.SetDisableDeepCopy(opts.UnsafeDisableDeepCopy)
+	im.SetSyncTimeout(opts.SyncTimeout)
+	im.SetWatchErrorHandler(opts.WatchErrorHandler)
+	if opts.SnapshotPath != "" {
+		if err := im.LoadSnapshot(opts.SnapshotPath); err != nil {
+			return nil, err
+		}
+	}
+
+	im.SetListOrder(opts.ListOrder)
+	im.SetTombstoneTTL(opts.TombstoneTTL)
+	if opts.WaitForCRD {
+		if err := im.WaitForCRDs(); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &informerCache{InformersMap: im}
+	if opts.ReadThrough {
+		c.liveReader, err = client.New(config, client.Options{Scheme: opts.Scheme, Mapper: opts.Mapper})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 func defaultOpts(config *rest.Config, opts Options) (Options, error) {
@@ -47,5 +117,9 @@ func defaultOpts(config *rest.Config, opts Options) (Options, error) {
 	if opts.Resync == nil {
 		opts.Resync = &defaultResyncTime
 	}
+
+	if opts.SyncTimeout == 0 {
+		opts.SyncTimeout = defaultSyncTimeout
+	}
 	return opts, nil
 }
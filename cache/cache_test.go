@@ -7,8 +7,11 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	kcache "k8s.io/client-go/tools/cache"
 
 	ut "github.com/cloudlinker/cement/unittest"
@@ -165,3 +168,269 @@ func TestPodCacheIndex(t *testing.T) {
 	ut.Equal(t, len(pods.Items), 1)
 	ut.Equal(t, pods.Items[0].Name, "test-pod-3")
 }
+
+func TestReadThrough(t *testing.T) {
+	env := testenv.NewEnv(os.Getenv("K8S_ASSETS"), nil)
+	err := env.Start()
+	ut.Assert(t, err == nil, "testenv cluster start failed:%v", err)
+	defer func() {
+		env.Stop()
+	}()
+
+	cli, err := client.New(env.Config, client.Options{})
+	ut.Assert(t, err == nil, "create client failed:%v", err)
+
+	c, err := New(env.Config, Options{})
+	ut.Assert(t, err == nil, "create cache failed:%v", err)
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "kubernetes"}, &corev1.Service{})
+	_, ok := err.(ErrCacheNotStarted)
+	ut.Assert(t, ok, "read before start should fail but get %v", err)
+
+	c, err = New(env.Config, Options{ReadThrough: true})
+	ut.Assert(t, err == nil, "create cache failed:%v", err)
+	svc := &corev1.Service{}
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "kubernetes"}, svc)
+	ut.Assert(t, err == nil, "read through before start failed:%v", err)
+	ut.Equal(t, svc.Name, "kubernetes")
+
+	testNamespace := "test-namespace-1"
+	for _, name := range []string{"test-pod-2", "test-pod-3"} {
+		err = cli.Create(context.TODO(), newPod(name, testNamespace, nil, corev1.RestartPolicyNever))
+		ut.Assert(t, err == nil, "create pod failed:%v", err)
+	}
+	pods := &corev1.PodList{}
+	err = c.List(context.TODO(), client.InNamespace(testNamespace).LimitTo(1), pods)
+	ut.Assert(t, err == nil, "read through list before start failed:%v", err)
+	ut.Assert(t, pods.Continue != "", "paged list should return a continue token")
+	apiServerToken := pods.Continue
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Start(stop)
+	ut.Assert(t, c.WaitForCacheSync(stop), "wait for sync should ok")
+
+	//the API server token can't be continued by the cache
+	err = c.List(context.TODO(), client.InNamespace(testNamespace).ContinueFrom(apiServerToken), pods)
+	ut.Assert(t, errors.IsResourceExpired(err), "continue from token of the API server should expire but get %v", err)
+
+	err = cli.Create(context.TODO(), newPod("test-pod-1", testNamespace, nil, corev1.RestartPolicyNever))
+	ut.Assert(t, err == nil, "create pod failed:%v", err)
+	pod := &corev1.Pod{}
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: testNamespace, Name: "test-pod-1"}, pod)
+	ut.Assert(t, err == nil, "read your write failed:%v", err)
+	ut.Equal(t, pod.Name, "test-pod-1")
+}
+
+func TestConsistencyChecker(t *testing.T) {
+	env := testenv.NewEnv(os.Getenv("K8S_ASSETS"), nil)
+	err := env.Start()
+	ut.Assert(t, err == nil, "testenv cluster start failed:%v", err)
+	defer func() {
+		env.Stop()
+	}()
+
+	cli, err := client.New(env.Config, client.Options{})
+	ut.Assert(t, err == nil, "create client failed:%v", err)
+
+	testNamespace := "test-namespace-1"
+	for _, name := range []string{"test-pod-1", "test-pod-2"} {
+		err = cli.Create(context.TODO(), newPod(name, testNamespace, nil, corev1.RestartPolicyNever))
+		ut.Assert(t, err == nil, "create pod failed:%v", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	c, err := New(env.Config, Options{})
+	ut.Assert(t, err == nil, "create cache failed:%v", err)
+	informer, err := c.GetInformer(&corev1.Pod{})
+	ut.Assert(t, err == nil, "get informer for pod failed:%v", err)
+	go c.Start(stop)
+	ut.Assert(t, c.WaitForCacheSync(stop), "wait for sync should ok")
+
+	checker := NewConsistencyChecker(c, cli, ConsistencyCheckOptions{Namespace: testNamespace, Repair: true})
+	podGVK := corev1.SchemeGroupVersion.WithKind("Pod")
+	report, err := checker.Check(context.TODO(), podGVK)
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Assert(t, !report.HasDrift(), "synced cache shouldn't drift")
+
+	//simulate a missed create and a missed delete
+	obj, _, _ := informer.GetIndexer().GetByKey(testNamespace + "/test-pod-1")
+	informer.GetIndexer().Delete(obj)
+	informer.GetIndexer().Add(newPod("test-pod-3", testNamespace, nil, corev1.RestartPolicyNever))
+	report, err = checker.Check(context.TODO(), podGVK)
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Equal(t, report.Missing, []client.ObjectKey{{Namespace: testNamespace, Name: "test-pod-1"}})
+	ut.Equal(t, report.Extra, []client.ObjectKey{{Namespace: testNamespace, Name: "test-pod-3"}})
+	ut.Assert(t, report.Repaired, "drift should be repaired")
+
+	report, err = checker.Check(context.TODO(), podGVK)
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Assert(t, !report.HasDrift(), "repaired cache shouldn't drift")
+}
+
+type fakeInformerCache struct {
+	Cache
+	informer kcache.SharedIndexInformer
+}
+
+func (c *fakeInformerCache) GetInformerForKind(gvk schema.GroupVersionKind) (kcache.SharedIndexInformer, error) {
+	return c.informer, nil
+}
+
+type fakeLiveReader struct {
+	pods map[string]*corev1.Pod
+	rv   string
+	//beforeList and afterList change objects while the live list is read
+	beforeList func()
+	afterList  func()
+	//onGet is called before every Get
+	onGet func(key client.ObjectKey)
+}
+
+func (r *fakeLiveReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if r.onGet != nil {
+		r.onGet(key)
+	}
+	pod, ok := r.pods[key.Name]
+	if !ok {
+		return errors.NewNotFound(schema.GroupResource{Resource: "pods"}, key.Name)
+	}
+	pod.DeepCopyInto(obj.(*corev1.Pod))
+	return nil
+}
+
+func (r *fakeLiveReader) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	if r.beforeList != nil {
+		r.beforeList()
+	}
+	podList := list.(*corev1.PodList)
+	podList.ResourceVersion = r.rv
+	for _, pod := range r.pods {
+		podList.Items = append(podList.Items, *pod.DeepCopy())
+	}
+	if r.afterList != nil {
+		r.afterList()
+	}
+	return nil
+}
+
+func TestConsistencyCheckerIgnoresConcurrentChange(t *testing.T) {
+	testNamespace := "test-namespace-1"
+	podWithRV := func(name, rv string) *corev1.Pod {
+		pod := newPod(name, testNamespace, nil, corev1.RestartPolicyNever)
+		pod.UID = types.UID(name)
+		pod.ResourceVersion = rv
+		return pod
+	}
+
+	informer := kcache.NewSharedIndexInformer(&kcache.ListWatch{}, &corev1.Pod{}, 0, kcache.Indexers{
+		kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
+	})
+	indexer := informer.GetIndexer()
+	for _, pod := range []*corev1.Pod{podWithRV("test-pod-1", "10"), podWithRV("test-pod-2", "10"), podWithRV("test-pod-4", "10")} {
+		indexer.Add(pod)
+	}
+	live := &fakeLiveReader{
+		rv: "10",
+		pods: map[string]*corev1.Pod{
+			"test-pod-1": podWithRV("test-pod-1", "10"),
+			"test-pod-2": podWithRV("test-pod-2", "10"),
+		},
+	}
+	checker := NewConsistencyChecker(&fakeInformerCache{informer: informer}, live, ConsistencyCheckOptions{Namespace: testNamespace, Repair: true})
+	podGVK := corev1.SchemeGroupVersion.WithKind("Pod")
+
+	//pod-1 is updated and pod-3 created right after the live list, the
+	//informer gets the events before the store is read
+	live.afterList = func() {
+		live.rv = "12"
+		live.pods["test-pod-1"] = podWithRV("test-pod-1", "11")
+		live.pods["test-pod-3"] = podWithRV("test-pod-3", "12")
+		indexer.Update(podWithRV("test-pod-1", "11"))
+		indexer.Add(podWithRV("test-pod-3", "12"))
+	}
+	report, err := checker.Check(context.TODO(), podGVK)
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Equal(t, report.Missing, []client.ObjectKey(nil))
+	ut.Equal(t, report.Stale, []client.ObjectKey(nil))
+	//pod-4 is a missed delete
+	ut.Equal(t, report.Extra, []client.ObjectKey{{Namespace: testNamespace, Name: "test-pod-4"}})
+	ut.Assert(t, report.Repaired, "drift should be repaired")
+	obj, exists, _ := indexer.GetByKey(testNamespace + "/test-pod-1")
+	ut.Assert(t, exists, "updated pod shouldn't be removed")
+	ut.Equal(t, obj.(*corev1.Pod).ResourceVersion, "11")
+	_, exists, _ = indexer.GetByKey(testNamespace + "/test-pod-3")
+	ut.Assert(t, exists, "created pod shouldn't be removed")
+	_, exists, _ = indexer.GetByKey(testNamespace + "/test-pod-4")
+	ut.Assert(t, !exists, "deleted pod should be removed")
+
+	//pod-1 is updated, pod-2 deleted and pod-5 created before the live list,
+	//the informer gets the events before the drift is confirmed
+	live.afterList = nil
+	live.beforeList = func() {
+		live.rv = "14"
+		live.pods["test-pod-1"] = podWithRV("test-pod-1", "13")
+		delete(live.pods, "test-pod-2")
+		live.pods["test-pod-5"] = podWithRV("test-pod-5", "14")
+		indexer.Update(podWithRV("test-pod-1", "13"))
+		indexer.Delete(podWithRV("test-pod-2", "10"))
+		indexer.Add(podWithRV("test-pod-5", "14"))
+	}
+	report, err = checker.Check(context.TODO(), podGVK)
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Assert(t, !report.HasDrift(), "delivered events shouldn't drift:%v", report)
+
+	//the list is served from a lagging API server, the cache is newer
+	live.beforeList = nil
+	indexer.Update(podWithRV("test-pod-1", "15"))
+	indexer.Add(podWithRV("test-pod-6", "16"))
+	report, err = checker.Check(context.TODO(), podGVK)
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Assert(t, !report.HasDrift(), "cache ahead of the list shouldn't drift:%v", report)
+	obj, _, _ = indexer.GetByKey(testNamespace + "/test-pod-1")
+	ut.Equal(t, obj.(*corev1.Pod).ResourceVersion, "15")
+}
+
+func TestConsistencyCheckerSkipsRepairOfChangedObject(t *testing.T) {
+	testNamespace := "test-namespace-1"
+	podWithRV := func(name, rv string) *corev1.Pod {
+		pod := newPod(name, testNamespace, nil, corev1.RestartPolicyNever)
+		pod.UID = types.UID(name)
+		pod.ResourceVersion = rv
+		return pod
+	}
+
+	informer := kcache.NewSharedIndexInformer(&kcache.ListWatch{}, &corev1.Pod{}, 0, kcache.Indexers{
+		kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
+	})
+	indexer := informer.GetIndexer()
+	indexer.Add(podWithRV("test-pod-1", "5"))
+	indexer.Add(podWithRV("test-pod-2", "5"))
+	live := &fakeLiveReader{
+		rv: "7",
+		pods: map[string]*corev1.Pod{
+			"test-pod-1": podWithRV("test-pod-1", "7"),
+			"test-pod-2": podWithRV("test-pod-2", "7"),
+		},
+	}
+
+	//both pods are stale, the informer updates the pod confirmed first
+	//while the other one is confirmed
+	var confirmed []string
+	live.onGet = func(key client.ObjectKey) {
+		confirmed = append(confirmed, key.Name)
+		if len(confirmed) == 2 {
+			indexer.Update(podWithRV(confirmed[0], "8"))
+		}
+	}
+	checker := NewConsistencyChecker(&fakeInformerCache{informer: informer}, live, ConsistencyCheckOptions{Namespace: testNamespace, Repair: true})
+	report, err := checker.Check(context.TODO(), corev1.SchemeGroupVersion.WithKind("Pod"))
+	ut.Assert(t, err == nil, "check failed:%v", err)
+	ut.Equal(t, len(report.Stale), 2)
+	ut.Assert(t, report.Repaired, "drift should be repaired")
+
+	obj, _, _ := indexer.GetByKey(testNamespace + "/" + confirmed[0])
+	ut.Equal(t, obj.(*corev1.Pod).ResourceVersion, "8")
+	obj, _, _ = indexer.GetByKey(testNamespace + "/" + confirmed[1])
+	ut.Equal(t, obj.(*corev1.Pod).ResourceVersion, "7")
+}
@@ -0,0 +1,335 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/cloudlinker/kubecarve/cache/internal"
+	"github.com/cloudlinker/kubecarve/client"
+)
+
+const (
+	driftMissing = "missing"
+	driftExtra   = "extra"
+	driftStale   = "stale"
+)
+
+// DriftReport is the difference between the informer store of one kind and
+// the objects on the API server
+type DriftReport struct {
+	GVK schema.GroupVersionKind
+	// Missing objects exist on the API server but not in the cache
+	Missing []client.ObjectKey
+	// Extra objects are in the cache but gone from the API server
+	Extra []client.ObjectKey
+	// Stale objects are in both, but with different UID or an older
+	// resourceVersion in the cache
+	Stale []client.ObjectKey
+	// Repaired is true if the store is fixed to match the API server
+	Repaired bool
+}
+
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Extra) > 0 || len(r.Stale) > 0
+}
+
+type ConsistencyCheckOptions struct {
+	// Scheme is used to create the list object of a kind, it should be the
+	// scheme of the cache
+	Scheme *runtime.Scheme
+	// Namespace restricts the check, it should be set if the cache is
+	// restricted to one namespace
+	Namespace string
+	// Repair writes the objects read from the API server into the store,
+	// and removes the extra ones. Repairs go to the store directly, no event
+	// is delivered to the event handlers of the informer. An object the
+	// informer changes after the check isn't repaired.
+	Repair bool
+	// OnReport is called with the result of every periodic check
+	OnReport func(report *DriftReport, err error)
+}
+
+// ConsistencyChecker compares informer stores against a live list from
+// the API server, it's a debug utility for suspected missed events. The
+// store is read before the list, and every difference is confirmed with a
+// live Get before it's reported, so an event the informer is about to
+// deliver isn't reported or repaired as drift.
+type ConsistencyChecker struct {
+	cache Cache
+	live  client.Reader
+	opts  ConsistencyCheckOptions
+}
+
+func NewConsistencyChecker(c Cache, live client.Reader, opts ConsistencyCheckOptions) *ConsistencyChecker {
+	if opts.Scheme == nil {
+		opts.Scheme = scheme.Scheme
+	}
+	return &ConsistencyChecker{
+		cache: c,
+		live:  live,
+		opts:  opts,
+	}
+}
+
+// Run checks every kind in gvks each interval until stop is closed
+func (cc *ConsistencyChecker) Run(stop <-chan struct{}, interval time.Duration, gvks ...schema.GroupVersionKind) {
+	wait.Until(func() {
+		for _, gvk := range gvks {
+			report, err := cc.Check(context.TODO(), gvk)
+			if cc.opts.OnReport != nil {
+				cc.opts.OnReport(report, err)
+			}
+		}
+	}, interval, stop)
+}
+
+// Check compares the store of gvk with the API server once
+func (cc *ConsistencyChecker) Check(ctx context.Context, gvk schema.GroupVersionKind) (*DriftReport, error) {
+	informer, err := cc.cache.GetInformerForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	// the store is read before the live list, so an object the informer
+	// receives after the list isn't taken for an extra one
+	indexer := informer.GetIndexer()
+	cached, err := cc.readStore(indexer)
+	if err != nil {
+		return nil, err
+	}
+
+	liveObjs, listRV, err := cc.listLive(ctx, gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	var suspects []client.ObjectKey
+	for _, liveObj := range liveObjs {
+		liveMeta, err := apimeta.Accessor(liveObj)
+		if err != nil {
+			return nil, err
+		}
+		key := client.ObjectKey{Namespace: liveMeta.GetNamespace(), Name: liveMeta.GetName()}
+		cachedObj, ok := cached[key]
+		if !ok {
+			suspects = append(suspects, key)
+			continue
+		}
+		delete(cached, key)
+
+		cachedMeta, err := apimeta.Accessor(cachedObj)
+		if err != nil {
+			return nil, err
+		}
+		if isStale(cachedMeta, liveMeta) {
+			suspects = append(suspects, key)
+		}
+	}
+	for key, cachedObj := range cached {
+		cachedMeta, err := apimeta.Accessor(cachedObj)
+		if err != nil {
+			return nil, err
+		}
+		// the cache has moved past the list
+		if resourceVersionOlder(listRV, cachedMeta.GetResourceVersion()) {
+			continue
+		}
+		suspects = append(suspects, key)
+	}
+
+	report := &DriftReport{GVK: gvk}
+	var repairs []func() error
+	for _, key := range suspects {
+		drift, repair, err := cc.confirm(ctx, gvk, indexer, key)
+		if err != nil {
+			return nil, err
+		}
+		switch drift {
+		case driftMissing:
+			report.Missing = append(report.Missing, key)
+		case driftExtra:
+			report.Extra = append(report.Extra, key)
+		case driftStale:
+			report.Stale = append(report.Stale, key)
+		default:
+			continue
+		}
+		repairs = append(repairs, repair)
+	}
+
+	driftObjectsTotal.WithLabelValues(gvk.Kind, driftMissing).Add(float64(len(report.Missing)))
+	driftObjectsTotal.WithLabelValues(gvk.Kind, driftExtra).Add(float64(len(report.Extra)))
+	driftObjectsTotal.WithLabelValues(gvk.Kind, driftStale).Add(float64(len(report.Stale)))
+	consistencyChecksTotal.WithLabelValues(gvk.Kind).Inc()
+
+	if cc.opts.Repair && report.HasDrift() {
+		for _, repair := range repairs {
+			if err := repair(); err != nil {
+				return report, err
+			}
+		}
+		report.Repaired = true
+	}
+	return report, nil
+}
+
+func (cc *ConsistencyChecker) readStore(indexer toolscache.Indexer) (map[client.ObjectKey]runtime.Object, error) {
+	var objs []interface{}
+	if cc.opts.Namespace != "" {
+		var err error
+		objs, err = indexer.ByIndex(toolscache.NamespaceIndex, cc.opts.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		objs = indexer.List()
+	}
+
+	cached := make(map[client.ObjectKey]runtime.Object, len(objs))
+	for _, obj := range objs {
+		o, ok := obj.(runtime.Object)
+		if !ok {
+			return nil, fmt.Errorf("cache contained %T, which is not an Object", obj)
+		}
+		key, err := client.ObjectKeyFromObject(o)
+		if err != nil {
+			return nil, err
+		}
+		cached[key] = o
+	}
+	return cached, nil
+}
+
+// confirm reads key from the API server and the store again, a suspected
+// drift caused by an event the informer hasn't delivered yet goes away,
+// and the repair uses the object just read
+func (cc *ConsistencyChecker) confirm(ctx context.Context, gvk schema.GroupVersionKind, indexer toolscache.Indexer, key client.ObjectKey) (string, func() error, error) {
+	liveObj, err := cc.opts.Scheme.New(gvk)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := cc.live.Get(ctx, key, liveObj); err != nil {
+		if !errors.IsNotFound(err) {
+			return "", nil, err
+		}
+		liveObj = nil
+	}
+
+	storeKey := internal.ObjectKeyToStoreKey(key)
+	obj, exists, err := indexer.GetByKey(storeKey)
+	if err != nil {
+		return "", nil, err
+	}
+	switch {
+	case liveObj == nil && !exists:
+		return "", nil, nil
+	case liveObj == nil:
+		return driftExtra, repairStore(indexer, storeKey, obj, nil), nil
+	case !exists:
+		return driftMissing, repairStore(indexer, storeKey, nil, liveObj), nil
+	}
+
+	cachedMeta, err := apimeta.Accessor(obj)
+	if err != nil {
+		return "", nil, err
+	}
+	liveMeta, err := apimeta.Accessor(liveObj)
+	if err != nil {
+		return "", nil, err
+	}
+	if !isStale(cachedMeta, liveMeta) {
+		return "", nil, nil
+	}
+	return driftStale, repairStore(indexer, storeKey, obj, liveObj), nil
+}
+
+func (cc *ConsistencyChecker) listLive(ctx context.Context, gvk schema.GroupVersionKind) ([]runtime.Object, string, error) {
+	list, err := cc.opts.Scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cc.live.List(ctx, client.InNamespace(cc.opts.Namespace), list); err != nil {
+		return nil, "", err
+	}
+	listMeta, err := apimeta.ListAccessor(list)
+	if err != nil {
+		return nil, "", err
+	}
+	objs, err := apimeta.ExtractList(list)
+	if err != nil {
+		return nil, "", err
+	}
+	return objs, listMeta.GetResourceVersion(), nil
+}
+
+// isStale is true if the cached object is replaced on the API server, or
+// is older than the live one, a cached object newer than the live one is
+// an update the list hasn't seen
+func isStale(cached, live metav1.Object) bool {
+	return cached.GetUID() != live.GetUID() ||
+		resourceVersionOlder(cached.GetResourceVersion(), live.GetResourceVersion())
+}
+
+// resourceVersionOlder compares resourceVersions as the integers the API
+// server uses, resourceVersions which aren't integers only compare equal
+func resourceVersionOlder(rv, other string) bool {
+	v, err1 := strconv.ParseUint(rv, 10, 64)
+	o, err2 := strconv.ParseUint(other, 10, 64)
+	if err1 != nil || err2 != nil {
+		return rv != other
+	}
+	return v < o
+}
+
+// repairStore makes the store hold liveObj under key, or drops key if
+// liveObj is nil. cached is what the store held when the drift was
+// confirmed, if the informer has changed the key since then, its event is
+// newer than liveObj and the store is left alone.
+func repairStore(indexer toolscache.Indexer, key string, cached interface{}, liveObj runtime.Object) func() error {
+	return func() error {
+		obj, exists, err := indexer.GetByKey(key)
+		if err != nil {
+			return err
+		}
+		if exists != (cached != nil) {
+			return nil
+		}
+		if exists {
+			if same, err := sameVersion(obj, cached); err != nil || !same {
+				return err
+			}
+		}
+
+		switch {
+		case liveObj == nil:
+			return indexer.Delete(cached)
+		case exists:
+			return indexer.Update(liveObj)
+		default:
+			return indexer.Add(liveObj)
+		}
+	}
+}
+
+func sameVersion(obj, other interface{}) (bool, error) {
+	meta, err := apimeta.Accessor(obj)
+	if err != nil {
+		return false, err
+	}
+	otherMeta, err := apimeta.Accessor(other)
+	if err != nil {
+		return false, err
+	}
+	return meta.GetUID() == otherMeta.GetUID() && meta.GetResourceVersion() == otherMeta.GetResourceVersion(), nil
+}
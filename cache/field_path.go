@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// FieldPathIndex declares an index of a kind over the values at a field
+// path, so it can be loaded from config files. Path is a dotted path like
+// spec.nodeName, or a JSONPath like metadata.ownerReferences[*].uid, and it
+// is also the field name used by field selectors.
+type FieldPathIndex struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+}
+
+func (i FieldPathIndex) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: i.Group, Version: i.Version, Kind: i.Kind}
+}
+
+// IndexFieldPaths registers every index in indexes, it should be called
+// before the cache is started
+func IndexFieldPaths(informers Informers, indexes []FieldPathIndex) error {
+	for _, index := range indexes {
+		if err := informers.IndexFieldPathForKind(index.GroupVersionKind(), index.Path); err != nil {
+			return fmt.Errorf("index %v by %s failed: %v", index.GroupVersionKind(), index.Path, err)
+		}
+	}
+	return nil
+}
+
+// FieldPathExtractor returns an IndexerFunc which extracts the values at
+// path, it works for both typed and unstructured objects. Values which
+// aren't strings are formatted with fmt, missing fields give no value.
+func FieldPathExtractor(path string) (IndexerFunc, error) {
+	expr := strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}"), ".")
+	if expr == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+
+	j := jsonpath.New(path).AllowMissingKeys(true)
+	if err := j.Parse("{." + expr + "}"); err != nil {
+		return nil, err
+	}
+
+	//jsonpath keeps state while evaluating
+	var mu sync.Mutex
+	return func(obj runtime.Object) []string {
+		var content map[string]interface{}
+		if u, ok := obj.(runtime.Unstructured); ok {
+			content = u.UnstructuredContent()
+		} else {
+			var err error
+			content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+			if err != nil {
+				return nil
+			}
+		}
+
+		mu.Lock()
+		results, err := j.FindResults(content)
+		mu.Unlock()
+		if err != nil {
+			return nil
+		}
+
+		var vals []string
+		for _, result := range results {
+			for _, v := range result {
+				if v.Kind() == reflect.Interface {
+					v = v.Elem()
+				}
+				if !v.IsValid() {
+					continue
+				}
+				switch v.Kind() {
+				case reflect.Map, reflect.Slice:
+					continue
+				case reflect.String:
+					vals = append(vals, v.String())
+				default:
+					vals = append(vals, fmt.Sprint(v.Interface()))
+				}
+			}
+		}
+		return vals
+	}, nil
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	ut "github.com/cloudlinker/cement/unittest"
+)
+
+func TestFieldPathExtractor(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod-1",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "rs-1", UID: "uid-1"},
+				{Kind: "ReplicaSet", Name: "rs-2", UID: "uid-2"},
+			},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	cases := []struct {
+		path string
+		vals []string
+	}{
+		{"spec.nodeName", []string{"node-1"}},
+		{"status.phase", []string{"Running"}},
+		{"metadata.ownerReferences[*].uid", []string{"uid-1", "uid-2"}},
+		{"{.metadata.ownerReferences[0].name}", []string{"rs-1"}},
+		{"spec.hostname", nil},
+	}
+	for _, c := range cases {
+		extract, err := FieldPathExtractor(c.path)
+		ut.Assert(t, err == nil, "parse path %s failed:%v", c.path, err)
+		ut.Equal(t, extract(pod), c.vals)
+	}
+
+	u := &unstructured.Unstructured{}
+	u.SetUnstructuredContent(map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": int64(3)},
+	})
+	extract, err := FieldPathExtractor("spec.replicas")
+	ut.Assert(t, err == nil, "parse path failed:%v", err)
+	ut.Equal(t, extract(u), []string{"3"})
+
+	_, err = FieldPathExtractor("")
+	ut.Assert(t, err != nil, "empty path should fail")
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -22,6 +23,13 @@ var (
 
 type informerCache struct {
 	*internal.InformersMap
+	// liveReader is only set in read through mode, reads which the
+	// informers can't serve yet go to the API server: all reads before
+	// the cache starts or the informer of the kind syncs, and Get of an
+	// object not found in the cache. It gives read-your-writes right after
+	// a Create, the extra requests are counted by the
+	// kubecarve_cache_read_through_total metric.
+	liveReader client.Reader
 }
 
 func (c *informerCache) Get(ctx context.Context, key client.ObjectKey, out runtime.Object) error {
@@ -30,11 +38,33 @@ func (c *informerCache) Get(ctx context.Context, key client.ObjectKey, out runti
 		return err
 	}
 
-	reader, err := c.InformersMap.GetInformer(gvk)
+	reader, reason, err := c.getReader(ctx, gvk)
 	if err != nil {
 		return err
 	}
-	return reader.Get(ctx, key, out)
+
+	if reader != nil {
+		err = reader.Get(ctx, key, out)
+		if c.liveReader == nil || !errors.IsNotFound(err) {
+			return err
+		}
+		reason = readThroughNotFound
+	}
+	readThroughTotal.WithLabelValues(gvk.Kind, reason).Inc()
+	return c.liveReader.Get(ctx, key, out)
+}
+
+func (c *informerCache) GetDeleted(ctx context.Context, key client.ObjectKey, out runtime.Object) error {
+	gvk, err := apiutil.GVKForObject(out, c.Scheme)
+	if err != nil {
+		return err
+	}
+
+	reader, err := c.InformersMap.EnsureInformer(gvk)
+	if err != nil {
+		return err
+	}
+	return reader.GetDeleted(ctx, key, out)
 }
 
 func (c *informerCache) List(ctx context.Context, opts *client.ListOptions, out runtime.Object) error {
@@ -59,16 +89,55 @@ func (c *informerCache) List(ctx context.Context, opts *client.ListOptions, out
 		return fmt.Errorf("cannot get cache for %T, its element %T is not a runtime.Object", out, cacheTypeValue.Interface())
 	}
 
-	reader, err := c.InformersMap.GetInformer(gvk)
+	reader, reason, err := c.getReader(ctx, gvk)
 	if err != nil {
 		return err
 	}
 
-	return reader.List(ctx, opts, out)
+	//in read through mode, pages of one list may be asked from both the
+	//API server and the informer, their continue tokens don't mix, so the
+	//list fails with an Expired error once its pages switch between them
+	fromCache := opts != nil && opts.Continue != "" && internal.IsCacheContinueToken(opts.Continue)
+	if reader != nil {
+		if c.liveReader != nil && opts != nil && opts.Continue != "" && !fromCache {
+			return errors.NewResourceExpired("the continue token is returned by the API server before the cache synced, list again from the start")
+		}
+		return reader.List(ctx, opts, out)
+	}
+	if fromCache {
+		return errors.NewResourceExpired("the continue token is returned by the cache, which can't serve the list now, list again from the start")
+	}
+	readThroughTotal.WithLabelValues(gvk.Kind, reason).Inc()
+	return c.liveReader.List(ctx, opts, out)
+}
+
+// getReader returns the informer of gvk, in read through mode it returns
+// the reason to read from the API server instead if the informer isn't
+// ready
+func (c *informerCache) getReader(ctx context.Context, gvk schema.GroupVersionKind) (*internal.ResourceInformer, string, error) {
+	if c.liveReader == nil {
+		if !c.Started() {
+			return nil, "", ErrCacheNotStarted{}
+		}
+		reader, err := c.InformersMap.GetInformer(ctx, gvk)
+		return reader, "", err
+	}
+
+	//create the informer anyway, so the following reads can be served by it
+	reader, err := c.InformersMap.EnsureInformer(gvk)
+	if err != nil {
+		return nil, "", err
+	}
+	if !c.Started() {
+		return nil, readThroughNotStarted, nil
+	} else if !reader.HasSynced() {
+		return nil, readThroughNotSynced, nil
+	}
+	return reader, "", nil
 }
 
 func (c *informerCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.SharedIndexInformer, error) {
-	return c.InformersMap.GetInformer(gvk)
+	return c.InformersMap.GetInformer(context.Background(), gvk)
 }
 
 func (c *informerCache) GetInformer(obj runtime.Object) (cache.SharedIndexInformer, error) {
@@ -76,7 +145,21 @@ func (c *informerCache) GetInformer(obj runtime.Object) (cache.SharedIndexInform
 	if err != nil {
 		return nil, err
 	}
-	return c.InformersMap.GetInformer(gvk)
+	return c.InformersMap.GetInformer(context.Background(), gvk)
+}
+
+func (c *informerCache) RemoveInformer(obj runtime.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme)
+	if err != nil {
+		return err
+	}
+	c.InformersMap.RemoveInformer(gvk)
+	return nil
+}
+
+func (c *informerCache) RemoveInformerForKind(gvk schema.GroupVersionKind) error {
+	c.InformersMap.RemoveInformer(gvk)
+	return nil
 }
 
 func (c *informerCache) IndexField(obj runtime.Object, field string, extractValue IndexerFunc) error {
@@ -87,6 +170,26 @@ func (c *informerCache) IndexField(obj runtime.Object, field string, extractValu
 	return indexByField(informer.GetIndexer(), field, extractValue)
 }
 
+func (c *informerCache) IndexFieldPath(obj runtime.Object, path string) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme)
+	if err != nil {
+		return err
+	}
+	return c.IndexFieldPathForKind(gvk, path)
+}
+
+func (c *informerCache) IndexFieldPathForKind(gvk schema.GroupVersionKind, path string) error {
+	extractValue, err := FieldPathExtractor(path)
+	if err != nil {
+		return err
+	}
+	informer, err := c.GetInformerForKind(gvk)
+	if err != nil {
+		return err
+	}
+	return indexByField(informer.GetIndexer(), path, extractValue)
+}
+
 func indexByField(indexer cache.Indexer, field string, extractor IndexerFunc) error {
 	indexFunc := func(objRaw interface{}) ([]string, error) {
 		obj, isObj := objRaw.(runtime.Object)
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"context"
+
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	toolscache "k8s.io/client-go/tools/cache"
@@ -19,14 +21,34 @@ type FieldIndexer interface {
 }
 
 type Informers interface {
+	// GetInformer and GetInformerForKind wait for a new informer to sync
+	// once the cache is started, ErrTimeout is returned after SyncTimeout
 	GetInformer(obj runtime.Object) (toolscache.SharedIndexInformer, error)
 	GetInformerForKind(gvk schema.GroupVersionKind) (toolscache.SharedIndexInformer, error)
 	Start(stopCh <-chan struct{}) error
 	WaitForCacheSync(stop <-chan struct{}) bool
 	IndexField(obj runtime.Object, field string, extractValue IndexerFunc) error
+	// IndexFieldPath indexes obj by the values at path, the path is also
+	// the field name to use in field selectors
+	IndexFieldPath(obj runtime.Object, path string) error
+	IndexFieldPathForKind(gvk schema.GroupVersionKind, path string) error
+	// RemoveInformer stops the informer for obj and drops its objects,
+	// event channels fed by the informer are closed
+	RemoveInformer(obj runtime.Object) error
+	RemoveInformerForKind(gvk schema.GroupVersionKind) error
+	// InformerStatuses reports the state of every informer in the cache,
+	// use it to find out which kind blocks WaitForCacheSync
+	InformerStatuses() []InformerStatus
+}
+
+// TombstoneReader reads the last known state of deleted objects
+type TombstoneReader interface {
+	// GetDeleted returns NotFound if the object isn't deleted recently
+	GetDeleted(ctx context.Context, key client.ObjectKey, obj runtime.Object) error
 }
 
 type Cache interface {
 	client.Reader
+	TombstoneReader
 	Informers
 }
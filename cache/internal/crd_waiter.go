@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// mappingGate holds the list and watch of a kind until its CRD is
+// established, and holds them again once the CRD is removed
+type mappingGate struct {
+	mu      sync.Mutex
+	mapping *meta.RESTMapping
+	// ready is closed when mapping is set
+	ready chan struct{}
+}
+
+func newMappingGate() *mappingGate {
+	return &mappingGate{
+		ready: make(chan struct{}),
+	}
+}
+
+func (g *mappingGate) open(mapping *meta.RESTMapping) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.mapping == nil {
+		close(g.ready)
+	}
+	g.mapping = mapping
+}
+
+func (g *mappingGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.mapping != nil {
+		g.mapping = nil
+		g.ready = make(chan struct{})
+	}
+}
+
+func (g *mappingGate) isOpen() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.mapping != nil
+}
+
+func (g *mappingGate) wait(stop <-chan struct{}) (*meta.RESTMapping, error) {
+	for {
+		g.mu.Lock()
+		mapping, ready := g.mapping, g.ready
+		g.mu.Unlock()
+		if mapping != nil {
+			return mapping, nil
+		}
+
+		select {
+		case <-ready:
+		case <-stop:
+			return nil, fmt.Errorf("informer stopped while waiting for CRD")
+		}
+	}
+}
+
+// crdWaiter watches CustomResourceDefinitions and opens the gates of the
+// kinds they define once established
+type crdWaiter struct {
+	informer cache.SharedIndexInformer
+	mu       sync.Mutex
+	gates    map[schema.GroupVersionKind]*mappingGate
+}
+
+func newCRDWaiter(config *rest.Config) (*crdWaiter, error) {
+	cs, err := apiextensionsclient.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	crds := cs.ApiextensionsV1beta1().CustomResourceDefinitions()
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return crds.List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return crds.Watch(opts)
+		},
+	}
+	w := &crdWaiter{
+		informer: cache.NewSharedIndexInformer(lw, &apiextensionsv1beta1.CustomResourceDefinition{}, 0, cache.Indexers{}),
+		gates:    make(map[schema.GroupVersionKind]*mappingGate),
+	}
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: w.onChange,
+		UpdateFunc: func(_, obj interface{}) {
+			w.onChange(obj)
+		},
+		DeleteFunc: w.onDelete,
+	})
+	return w, nil
+}
+
+func (w *crdWaiter) start(stop <-chan struct{}) {
+	go w.informer.Run(stop)
+}
+
+func (w *crdWaiter) addGate(gvk schema.GroupVersionKind) *mappingGate {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	gate := newMappingGate()
+	w.gates[gvk] = gate
+
+	//the CRD may be established already
+	for _, obj := range w.informer.GetStore().List() {
+		crd := obj.(*apiextensionsv1beta1.CustomResourceDefinition)
+		if mapping := crdMapping(crd, gvk); mapping != nil && crdEstablished(crd) {
+			gate.open(mapping)
+		}
+	}
+	return gate
+}
+
+func (w *crdWaiter) removeGate(gvk schema.GroupVersionKind) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.gates, gvk)
+}
+
+func (w *crdWaiter) onChange(obj interface{}) {
+	crd, ok := obj.(*apiextensionsv1beta1.CustomResourceDefinition)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for gvk, gate := range w.gates {
+		mapping := crdMapping(crd, gvk)
+		if mapping == nil {
+			continue
+		}
+		//a terminating CRD loses Established
+		if crdEstablished(crd) {
+			gate.open(mapping)
+		} else {
+			gate.close()
+		}
+	}
+}
+
+func (w *crdWaiter) onDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	crd, ok := obj.(*apiextensionsv1beta1.CustomResourceDefinition)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for gvk, gate := range w.gates {
+		if crd.Spec.Group == gvk.Group && crd.Spec.Names.Kind == gvk.Kind {
+			gate.close()
+		}
+	}
+}
+
+func crdEstablished(crd *apiextensionsv1beta1.CustomResourceDefinition) bool {
+	for _, cond := range crd.Status.Conditions {
+		if cond.Type == apiextensionsv1beta1.Established {
+			return cond.Status == apiextensionsv1beta1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// crdMapping returns the mapping of gvk if the CRD defines and serves it
+func crdMapping(crd *apiextensionsv1beta1.CustomResourceDefinition, gvk schema.GroupVersionKind) *meta.RESTMapping {
+	if crd.Spec.Group != gvk.Group || crd.Spec.Names.Kind != gvk.Kind {
+		return nil
+	}
+
+	served := crd.Spec.Version == gvk.Version
+	for _, v := range crd.Spec.Versions {
+		if v.Name == gvk.Version {
+			served = v.Served
+		}
+	}
+	if !served {
+		return nil
+	}
+
+	scope := meta.RESTScopeNamespace
+	if crd.Spec.Scope == apiextensionsv1beta1.ClusterScoped {
+		scope = meta.RESTScopeRoot
+	}
+	return &meta.RESTMapping{
+		Resource:         gvk.GroupVersion().WithResource(crd.Spec.Names.Plural),
+		GroupVersionKind: gvk,
+		Scope:            scope,
+	}
+}
+
+// WaitForCRDs makes the informers of kinds unknown to the RESTMapper wait
+// for their CRD instead of failing, they start once the CRD is established
+// and pause once it is removed. A waiting informer is pending, reads return
+// nothing and WaitForCacheSync doesn't wait for it.
+func (m *InformersMap) WaitForCRDs() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.crdWaiter != nil {
+		return nil
+	}
+
+	w, err := newCRDWaiter(m.config)
+	if err != nil {
+		return err
+	}
+	m.crdWaiter = w
+	if m.started {
+		w.start(m.stop)
+	}
+	return nil
+}
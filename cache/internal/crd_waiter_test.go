@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	ut "github.com/cloudlinker/cement/unittest"
+)
+
+func newCRD(established bool) *apiextensionsv1beta1.CustomResourceDefinition {
+	status := apiextensionsv1beta1.ConditionFalse
+	if established {
+		status = apiextensionsv1beta1.ConditionTrue
+	}
+	return &apiextensionsv1beta1.CustomResourceDefinition{
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group:   "example.com",
+			Version: "v1",
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Plural: "foos",
+				Kind:   "Foo",
+			},
+			Scope: apiextensionsv1beta1.ClusterScoped,
+		},
+		Status: apiextensionsv1beta1.CustomResourceDefinitionStatus{
+			Conditions: []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+				{Type: apiextensionsv1beta1.Established, Status: status},
+			},
+		},
+	}
+}
+
+func TestCRDMapping(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Foo"}
+	mapping := crdMapping(newCRD(true), gvk)
+	ut.Assert(t, mapping != nil, "crd should define foo")
+	ut.Equal(t, mapping.Resource.Resource, "foos")
+	ut.Equal(t, mapping.Scope.Name(), meta.RESTScopeNameRoot)
+
+	ut.Assert(t, crdMapping(newCRD(true), gvk.GroupVersion().WithKind("Bar")) == nil, "crd shouldn't define bar")
+	ut.Assert(t, crdMapping(newCRD(true), schema.GroupVersionKind{Group: "example.com", Version: "v2", Kind: "Foo"}) == nil, "crd shouldn't serve v2")
+}
+
+func TestCRDWaiterGate(t *testing.T) {
+	w := &crdWaiter{gates: make(map[schema.GroupVersionKind]*mappingGate)}
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Foo"}
+	gate := newMappingGate()
+	w.gates[gvk] = gate
+
+	stop := make(chan struct{})
+	defer close(stop)
+	mappingCh := make(chan *meta.RESTMapping)
+	go func() {
+		mapping, _ := gate.wait(stop)
+		mappingCh <- mapping
+	}()
+
+	w.onChange(newCRD(false))
+	ut.Assert(t, !gate.isOpen(), "gate shouldn't open before crd established")
+	w.onChange(newCRD(true))
+	select {
+	case mapping := <-mappingCh:
+		ut.Equal(t, mapping.Resource.Resource, "foos")
+	case <-time.After(time.Second):
+		t.Fatal("wait should return once crd established")
+	}
+
+	w.onDelete(newCRD(true))
+	ut.Assert(t, !gate.isOpen(), "gate should close once crd deleted")
+}
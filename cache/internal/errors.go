@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrCacheNotStarted is returned when reading from a cache which isn't started
+type ErrCacheNotStarted struct{}
+
+func (ErrCacheNotStarted) Error() string {
+	return "the cache is not started, can not read objects"
+}
+
+// ErrTimeout is returned when the informer of a kind doesn't sync before
+// the deadline of the read
+type ErrTimeout struct {
+	GVK schema.GroupVersionKind
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("timeout waiting for %v informer to sync", e.GVK)
+}
@@ -1,10 +1,13 @@
 package internal
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -17,6 +20,8 @@ import (
 	"github.com/cloudlinker/kubecarve/client/apiutil"
 )
 
+const syncPollPeriod = 100 * time.Millisecond
+
 func NewInformersMap(config *rest.Config,
 	scheme *runtime.Scheme,
 	mapper meta.RESTMapper,
@@ -47,8 +52,28 @@ type InformersMap struct {
 	mu             sync.RWMutex
 	started        bool
 	namespace      string
+	// kinds whose reads skip DeepCopy and return the cached objects
+	disableDeepCopy map[schema.GroupVersionKind]bool
+	// syncTimeout bounds the wait for a new informer to sync when the
+	// caller's context has no deadline, zero means no bound
+	syncTimeout time.Duration
+	// watchErrorHandler is called with every failed list or watch
+	watchErrorHandler WatchErrorHandler
+	// snapshotPath is where the stores are saved on stop, snapshots are
+	// loaded from it and consumed by the informers for warm start
+	snapshotPath string
+	snapshots    map[schema.GroupVersionKind]*kindSnapshot
+	// crdWaiter is set if informers of unknown kinds wait for their CRD
+	crdWaiter *crdWaiter
+	listLess  LessFunc
+	// tombstoneTTL is how long deleted objects of each kind are kept
+	tombstoneTTL map[schema.GroupVersionKind]time.Duration
 }
 
+// WatchErrorHandler is called when listing or watching a kind fails, the
+// informer keeps retrying unless it is removed from the map
+type WatchErrorHandler func(gvk schema.GroupVersionKind, err error)
+
 func (m *InformersMap) Start(stop <-chan struct{}) error {
 	go func() {
 		m.mu.Lock()
@@ -56,66 +81,257 @@ func (m *InformersMap) Start(stop <-chan struct{}) error {
 		for _, informer := range m.informersByGVK {
 			go informer.Run(stop)
 		}
+		if m.crdWaiter != nil {
+			m.crdWaiter.start(stop)
+		}
 		m.started = true
 		m.mu.Unlock()
 	}()
 	<-stop
+
+	if m.snapshotPath != "" {
+		return m.saveSnapshot()
+	}
 	return nil
 }
 
 func (m *InformersMap) WaitForCacheSync(stop <-chan struct{}) bool {
+	if !cache.WaitForCacheSync(stop, m.Started) {
+		return false
+	}
 	syncedFuncs := append([]cache.InformerSynced(nil), m.hasSyncedFuncs()...)
 	return cache.WaitForCacheSync(stop, syncedFuncs...)
 }
 
+func (m *InformersMap) Started() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.started
+}
+
 func (m *InformersMap) hasSyncedFuncs() []cache.InformerSynced {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	syncedFuncs := make([]cache.InformerSynced, 0, len(m.informersByGVK))
 	for _, informer := range m.informersByGVK {
-		syncedFuncs = append(syncedFuncs, informer.HasSynced)
+		informer := informer
+		//pending informers would block until their CRD is installed
+		syncedFuncs = append(syncedFuncs, func() bool {
+			return informer.Pending() || informer.HasSynced()
+		})
 	}
 	return syncedFuncs
 }
 
-func (m *InformersMap) GetInformer(gvk schema.GroupVersionKind) (*ResourceInformer, error) {
+// GetInformer returns the informer of gvk, creating it if it doesn't exist.
+// Once the map is started, it waits for the informer to sync until ctx is
+// done, the wait doesn't block other callers.
+func (m *InformersMap) GetInformer(ctx context.Context, gvk schema.GroupVersionKind) (*ResourceInformer, error) {
+	c, stop, err := m.getOrCreateInformer(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	if stop == nil || c.Pending() || c.HasSynced() {
+		return c, nil
+	}
+
+	m.mu.RLock()
+	syncTimeout := m.syncTimeout
+	m.mu.RUnlock()
+	if _, ok := ctx.Deadline(); !ok && syncTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, syncTimeout)
+		defer cancel()
+	}
+	if err := waitForSync(ctx, stop, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// EnsureInformer is like GetInformer but never waits for the informer
+// to sync
+func (m *InformersMap) EnsureInformer(gvk schema.GroupVersionKind) (*ResourceInformer, error) {
+	c, _, err := m.getOrCreateInformer(gvk)
+	return c, err
+}
+
+// getOrCreateInformer returns the stop channel of the map as well, which
+// is nil if the map isn't started yet
+func (m *InformersMap) getOrCreateInformer(gvk schema.GroupVersionKind) (*ResourceInformer, <-chan struct{}, error) {
+	m.mu.RLock()
+	c, ok := m.informersByGVK[gvk]
+	stop := m.stop
+	m.mu.RUnlock()
+	if ok {
+		return c, stop, nil
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-
 	if c, ok := m.informersByGVK[gvk]; ok {
-		return c, nil
-	} else {
-		return m.createResourceCache(gvk)
+		return c, m.stop, nil
+	}
+
+	c, err := m.createResourceCache(gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, m.stop, nil
+}
+
+func waitForSync(ctx context.Context, stop <-chan struct{}, c *ResourceInformer) error {
+	ticker := time.NewTicker(syncPollPeriod)
+	defer ticker.Stop()
+	for !c.HasSynced() {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return ErrTimeout{GVK: c.groupVersionKind}
+			}
+			return ctx.Err()
+		case <-stop:
+			return fmt.Errorf("cache is stopped before %v informer synced", c.groupVersionKind)
+		case <-c.Done():
+			return fmt.Errorf("%v informer is removed before synced", c.groupVersionKind)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// SetDisableDeepCopy makes reads of the kinds return the cached objects
+// without DeepCopy for the informers created after. The returned objects
+// are shared with the cache and every other reader, they must never be
+// modified.
+func (m *InformersMap) SetDisableDeepCopy(kinds []schema.GroupVersionKind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disableDeepCopy = make(map[schema.GroupVersionKind]bool)
+	for _, gvk := range kinds {
+		m.disableDeepCopy[gvk] = true
+	}
+}
+
+// SetSyncTimeout bounds the wait of GetInformer for a new informer to
+// sync, if the context has no deadline. Zero means waiting until the
+// informer synced.
+func (m *InformersMap) SetSyncTimeout(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncTimeout = timeout
+}
+
+// SetWatchErrorHandler sets the handler of the list and watch errors of
+// the informers created after
+func (m *InformersMap) SetWatchErrorHandler(handler WatchErrorHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchErrorHandler = handler
+}
+
+// SetListOrder sets the order of List results for the informers created
+// after, items less doesn't tell apart and all items if less is nil are
+// ordered by namespace/name. A continue token of a custom order expires
+// once the last item of its page is deleted.
+func (m *InformersMap) SetListOrder(less LessFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listLess = less
+}
+
+// SetTombstoneTTL keeps deleted objects of the kinds in ttl for the
+// informers created after, objects deleted while the informer missed the
+// event are kept as well
+func (m *InformersMap) SetTombstoneTTL(ttl map[schema.GroupVersionKind]time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tombstoneTTL = ttl
+}
+
+// InformerStatuses reports the state of every informer, sorted by kind
+func (m *InformersMap) InformerStatuses() []InformerStatus {
+	m.mu.RLock()
+	statuses := make([]InformerStatus, 0, len(m.informersByGVK))
+	for _, c := range m.informersByGVK {
+		statuses = append(statuses, c.Status())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].GVK.String() < statuses[j].GVK.String()
+	})
+	return statuses
+}
+
+// RemoveInformer stops the informer of gvk and forgets it, a later
+// GetInformer creates a new one
+func (m *InformersMap) RemoveInformer(gvk schema.GroupVersionKind) {
+	m.mu.Lock()
+	c, ok := m.informersByGVK[gvk]
+	if ok {
+		delete(m.informersByGVK, gvk)
+		if m.crdWaiter != nil {
+			m.crdWaiter.removeGate(gvk)
+		}
+	}
+	m.mu.Unlock()
+
+	if ok {
+		c.Stop()
 	}
 }
 
 func (m *InformersMap) createResourceCache(gvk schema.GroupVersionKind) (*ResourceInformer, error) {
-	lw, err := m.createListWatcher(gvk)
+	obj, err := m.Scheme.New(gvk)
 	if err != nil {
 		return nil, err
 	}
-	obj, err := m.Scheme.New(gvk)
+
+	c := newResourceCache(nil, gvk, m.disableDeepCopy[gvk])
+	c.listLess = m.listLess
+	lw, err := m.createListWatcher(gvk, c)
 	if err != nil {
 		return nil, err
 	}
-	c := newResourceCache(
-		cache.NewSharedIndexInformer(lw, obj, m.resync, cache.Indexers{
-			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
-		}), gvk)
+	c.SharedIndexInformer = cache.NewSharedIndexInformer(lw, obj, m.resync, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	if ttl := m.tombstoneTTL[gvk]; ttl > 0 {
+		c.keepTombstones(ttl)
+	}
 
 	m.informersByGVK[gvk] = c
 	if m.started {
 		go c.Run(m.stop)
-		if !cache.WaitForCacheSync(m.stop, c.HasSynced) {
-			return nil, fmt.Errorf("failed waiting for %T Informer to sync", gvk)
-		}
 	}
 	return c, nil
 }
 
-func (m *InformersMap) createListWatcher(gvk schema.GroupVersionKind) (*cache.ListWatch, error) {
+func (m *InformersMap) createListWatcher(gvk schema.GroupVersionKind, c *ResourceInformer) (*cache.ListWatch, error) {
+	handler := m.watchErrorHandler
+	onError := func(err error) {
+		c.setLastError(err)
+		if handler != nil {
+			handler(gvk, err)
+		}
+	}
+
+	//getMapping blocks until the CRD of a pending kind is established
+	var getMapping func() (*meta.RESTMapping, error)
 	mapping, err := m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
-	if err != nil {
+	if err == nil {
+		getMapping = func() (*meta.RESTMapping, error) {
+			return mapping, nil
+		}
+	} else if meta.IsNoMatchError(err) && m.crdWaiter != nil {
+		gate := m.crdWaiter.addGate(gvk)
+		c.gate = gate
+		getMapping = func() (*meta.RESTMapping, error) {
+			return gate.wait(c.Stopping())
+		}
+	} else {
 		return nil, err
 	}
 
@@ -130,24 +346,82 @@ func (m *InformersMap) createListWatcher(gvk schema.GroupVersionKind) (*cache.Li
 	}
 
 	return &cache.ListWatch{
-		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+		ListFunc: warmStartListFunc(m.popSnapshot(gvk), listObj, func(opts metav1.ListOptions) (runtime.Object, error) {
+			mapping, err := getMapping()
+			if err != nil {
+				return nil, err
+			}
 			res := listObj.DeepCopyObject()
 			isNamespaceScoped := m.namespace != "" && mapping.Scope.Name() != meta.RESTScopeNameRoot
-			err := client.Get().
+			err = client.Get().
 				NamespaceIfScoped(m.namespace, isNamespaceScoped).
 				Resource(mapping.Resource.Resource).
 				VersionedParams(&opts, m.paramCodec).
 				Do().Into(res)
+			if err != nil {
+				onError(err)
+			}
 			return res, err
-		},
+		}),
 		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			mapping, err := getMapping()
+			if err != nil {
+				return nil, err
+			}
 			opts.Watch = true
 			isNamespaceScoped := m.namespace != "" && mapping.Scope.Name() != meta.RESTScopeNameRoot
-			return client.Get().
+			w, err := client.Get().
 				NamespaceIfScoped(m.namespace, isNamespaceScoped).
 				Resource(mapping.Resource.Resource).
 				VersionedParams(&opts, m.paramCodec).
 				Watch()
+			if err != nil {
+				onError(err)
+				return nil, err
+			}
+			return newErrorReportingWatch(w, onError), nil
 		},
 	}, nil
 }
+
+// errorReportingWatch reports the error events of a watch stream, like an
+// expired resource version, the reflector only logs them before watching
+// again. A stream which fails to decode is closed without an error event
+// by client-go, so it isn't reported.
+type errorReportingWatch struct {
+	watch.Interface
+	result chan watch.Event
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newErrorReportingWatch(w watch.Interface, onError func(error)) watch.Interface {
+	rw := &errorReportingWatch{
+		Interface: w,
+		result:    make(chan watch.Event),
+		stop:      make(chan struct{}),
+	}
+	go func() {
+		defer close(rw.result)
+		for e := range w.ResultChan() {
+			if e.Type == watch.Error {
+				onError(errors.FromObject(e.Object))
+			}
+			select {
+			case rw.result <- e:
+			case <-rw.stop:
+				return
+			}
+		}
+	}()
+	return rw
+}
+
+func (w *errorReportingWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *errorReportingWatch) Stop() {
+	w.once.Do(func() { close(w.stop) })
+	w.Interface.Stop()
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+
+	ut "github.com/cloudlinker/cement/unittest"
+)
+
+func TestWaitForSyncTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	//list never returns, just like a forbidden kind retrying forever
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			<-stop
+			return &corev1.PodList{}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	c := newResourceCache(cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{}), gvk, false)
+	go c.Run(stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := waitForSync(ctx, stop, c)
+	timeoutErr, ok := err.(ErrTimeout)
+	ut.Assert(t, ok, "should get timeout error but get %v", err)
+	ut.Equal(t, timeoutErr.GVK, gvk)
+}
+
+func TestSlowInformerNotBlockOtherKind(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	newInformer := func(gvk schema.GroupVersionKind, listed <-chan struct{}) *ResourceInformer {
+		lw := &cache.ListWatch{
+			ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+				select {
+				case <-listed:
+				case <-stop:
+				}
+				return &corev1.PodList{}, nil
+			},
+			WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+				return watch.NewFake(), nil
+			},
+		}
+		return newResourceCache(cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{}), gvk, false)
+	}
+
+	slowGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	fastGVK := schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+	listed := make(chan struct{})
+	close(listed)
+	m := NewInformersMap(nil, scheme.Scheme, nil, 0, "")
+	m.informersByGVK[slowGVK] = newInformer(slowGVK, nil)
+	m.informersByGVK[fastGVK] = newInformer(fastGVK, listed)
+	m.stop = stop
+	m.started = true
+	for _, c := range m.informersByGVK {
+		go c.Run(stop)
+	}
+
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := m.GetInformer(context.Background(), slowGVK)
+		slowDone <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := m.GetInformer(ctx, fastGVK)
+	ut.Assert(t, err == nil, "get informer of synced kind failed:%v", err)
+	ut.Assert(t, c.HasSynced(), "informer should be synced")
+	select {
+	case err := <-slowDone:
+		t.Fatalf("slow informer shouldn't return but get %v", err)
+	default:
+	}
+
+	//the sync timeout bounds a wait without deadline
+	m2 := NewInformersMap(nil, scheme.Scheme, nil, 0, "")
+	m2.SetSyncTimeout(200 * time.Millisecond)
+	m2.informersByGVK[slowGVK] = m.informersByGVK[slowGVK]
+	m2.stop = stop
+	m2.started = true
+	_, err = m2.GetInformer(context.Background(), slowGVK)
+	_, ok := err.(ErrTimeout)
+	ut.Assert(t, ok, "should get timeout error but get %v", err)
+}
+
+func TestWatchErrorEventReported(t *testing.T) {
+	fw := watch.NewFake()
+	var errs []error
+	w := newErrorReportingWatch(fw, func(err error) {
+		errs = append(errs, err)
+	})
+
+	go fw.Error(&metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusGone,
+		Reason:  metav1.StatusReasonExpired,
+		Message: "too old resource version",
+	})
+	e := <-w.ResultChan()
+	ut.Equal(t, e.Type, watch.Error)
+	ut.Equal(t, len(errs), 1)
+	ut.Assert(t, errors.IsResourceExpired(errs[0]), "should report expired error but get %v", errs[0])
+
+	w.Stop()
+	_, ok := <-w.ResultChan()
+	ut.Assert(t, !ok, "result channel should be closed once stopped")
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/cloudlinker/kubecarve/client"
+)
+
+// LessFunc reports whether a should be listed before b
+type LessFunc func(a, b runtime.Object) bool
+
+// continueTokenVersion tells the tokens of the cache from the ones of the
+// API server, which are versioned as "meta.k8s.io/v1"
+const continueTokenVersion = "cache.kubecarve/v1"
+
+// continueToken marks where the next page starts, it holds the store key
+// of the last item returned
+type continueToken struct {
+	Version string `json:"v"`
+	Key     string `json:"key"`
+}
+
+// IsCacheContinueToken reports whether token is returned by a cache List,
+// rather than by the API server
+func IsCacheContinueToken(token string) bool {
+	_, err := decodeContinueToken(token)
+	return err == nil
+}
+
+func encodeContinueToken(key string) (string, error) {
+	data, err := json.Marshal(&continueToken{Version: continueTokenVersion, Key: key})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeContinueToken(token string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.NewBadRequest("invalid continue token")
+	}
+	var t continueToken
+	if err := json.Unmarshal(data, &t); err != nil || t.Version != continueTokenVersion || t.Key == "" {
+		return "", errors.NewBadRequest("invalid continue token")
+	}
+	return t.Key, nil
+}
+
+// storeKey returns the store key of obj, objects in the store always have
+// meta, an empty key is returned otherwise
+func storeKey(obj runtime.Object) string {
+	meta, err := apimeta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return ObjectKeyToStoreKey(client.ObjectKey{Namespace: meta.GetNamespace(), Name: meta.GetName()})
+}
+
+// sortItems sorts by less, items less doesn't tell apart are ordered by
+// namespace/name, so the order is always deterministic
+func sortItems(items []runtime.Object, less LessFunc) {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = storeKey(item)
+	}
+	sort.Sort(&sortableItems{items: items, keys: keys, less: less})
+}
+
+type sortableItems struct {
+	items []runtime.Object
+	keys  []string
+	less  LessFunc
+}
+
+func (s *sortableItems) Len() int {
+	return len(s.items)
+}
+
+func (s *sortableItems) Less(i, j int) bool {
+	if s.less != nil {
+		if s.less(s.items[i], s.items[j]) {
+			return true
+		} else if s.less(s.items[j], s.items[i]) {
+			return false
+		}
+	}
+	return s.keys[i] < s.keys[j]
+}
+
+func (s *sortableItems) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// pageItems returns the page of sorted items starting after the continue
+// token and the token of the next page, which is empty on the last page
+func pageItems(items []runtime.Object, less LessFunc, limit int64, token string) ([]runtime.Object, string, error) {
+	if token != "" {
+		lastKey, err := decodeContinueToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+
+		start := -1
+		if less == nil {
+			start = sort.Search(len(items), func(i int) bool {
+				return storeKey(items[i]) > lastKey
+			})
+		} else {
+			for i, item := range items {
+				if storeKey(item) == lastKey {
+					start = i + 1
+					break
+				}
+			}
+		}
+		if start == -1 {
+			return nil, "", errors.NewResourceExpired("the last listed object is gone, list again from the start")
+		}
+		items = items[start:]
+	}
+
+	if limit <= 0 || int64(len(items)) <= limit {
+		return items, "", nil
+	}
+	items = items[:limit]
+	next, err := encodeContinueToken(storeKey(items[len(items)-1]))
+	if err != nil {
+		return nil, "", err
+	}
+	return items, next, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
@@ -12,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/cloudlinker/kubecarve/client"
@@ -22,23 +25,159 @@ var _ client.Reader = &ResourceInformer{}
 type ResourceInformer struct {
 	cache.SharedIndexInformer
 	groupVersionKind schema.GroupVersionKind //this field only used to generate error :(
+	// disableDeepCopy makes Get and List hand out the cached objects
+	// directly, callers must treat them as read-only
+	disableDeepCopy bool
+
+	mu      sync.Mutex
+	running bool
+	stopped bool
+	// stopCh is closed once the informer is asked to stop, doneCh is
+	// closed once no event handler will be called anymore
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	lastError     error
+	lastErrorTime time.Time
+
+	// gate is only set for kinds waiting for their CRD
+	gate *mappingGate
+	// listLess orders List results, namespace/name order if it's nil
+	listLess LessFunc
+	// tombstones keeps deleted objects for tombstoneTTL if it's set
+	tombstones   cache.Store
+	tombstoneTTL time.Duration
 }
 
-func newResourceCache(informer cache.SharedIndexInformer, groupVersionKind schema.GroupVersionKind) *ResourceInformer {
+// InformerStatus is a snapshot of the state of one informer
+type InformerStatus struct {
+	GVK schema.GroupVersionKind
+	// Pending is true if the informer waits for the CRD of the kind
+	Pending                 bool
+	Synced                  bool
+	LastSyncResourceVersion string
+	ObjectCount             int
+	// LastError is the latest list or watch failure, it's kept after the
+	// informer recovered, compare LastErrorTime to tell
+	LastError     error
+	LastErrorTime time.Time
+}
+
+func newResourceCache(informer cache.SharedIndexInformer, groupVersionKind schema.GroupVersionKind, disableDeepCopy bool) *ResourceInformer {
 	return &ResourceInformer{
 		SharedIndexInformer: informer,
 		groupVersionKind:    groupVersionKind,
+		disableDeepCopy:     disableDeepCopy,
+		stopCh:              make(chan struct{}),
+		doneCh:              make(chan struct{}),
+	}
+}
+
+// Run runs the informer until stop is closed or Stop is called
+func (c *ResourceInformer) Run(stop <-chan struct{}) {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.running = true
+	c.mu.Unlock()
+
+	defer close(c.doneCh)
+	go func() {
+		select {
+		case <-stop:
+			c.Stop()
+		case <-c.stopCh:
+		}
+	}()
+	if c.tombstones != nil {
+		//expired tombstones are only dropped when they are read
+		go wait.Until(func() {
+			c.tombstones.List()
+		}, c.tombstoneTTL, c.stopCh)
+	}
+	c.SharedIndexInformer.Run(c.stopCh)
+}
+
+// Stop stops the informer, an informer which is stopped can't run again
+func (c *ResourceInformer) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
 	}
+	c.stopped = true
+	close(c.stopCh)
+	if !c.running {
+		close(c.doneCh)
+	}
+}
+
+// Pending returns true if the CRD of the kind isn't established, the
+// informer doesn't list or watch until it is
+func (c *ResourceInformer) Pending() bool {
+	return c.gate != nil && !c.gate.isOpen()
+}
+
+func (c *ResourceInformer) Status() InformerStatus {
+	c.mu.Lock()
+	lastError, lastErrorTime := c.lastError, c.lastErrorTime
+	c.mu.Unlock()
+
+	return InformerStatus{
+		GVK:                     c.groupVersionKind,
+		Pending:                 c.Pending(),
+		Synced:                  c.HasSynced(),
+		LastSyncResourceVersion: c.LastSyncResourceVersion(),
+		ObjectCount:             len(c.GetStore().ListKeys()),
+		LastError:               lastError,
+		LastErrorTime:           lastErrorTime,
+	}
+}
+
+func (c *ResourceInformer) setLastError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err
+	c.lastErrorTime = time.Now()
+}
+
+// Stopping is closed once the informer is asked to stop, event handlers
+// blocking on anything should give up when it's closed
+func (c *ResourceInformer) Stopping() <-chan struct{} {
+	return c.stopCh
+}
+
+// Done is closed once the informer has stopped and all event handler
+// calls have returned
+func (c *ResourceInformer) Done() <-chan struct{} {
+	return c.doneCh
 }
 
 func (c *ResourceInformer) Get(_ context.Context, key client.ObjectKey, out runtime.Object) error {
-	storeKey := objectKeyToStoreKey(key)
+	obj, exists, err := c.GetIndexer().GetByKey(ObjectKeyToStoreKey(key))
+	if err != nil {
+		return err
+	}
+	return c.getObject(key, obj, exists, !c.disableDeepCopy, out)
+}
 
-	obj, exists, err := c.GetIndexer().GetByKey(storeKey)
+// GetDeleted returns the last known state of a deleted object, it only
+// works if tombstones are kept for the kind
+func (c *ResourceInformer) GetDeleted(_ context.Context, key client.ObjectKey, out runtime.Object) error {
+	if c.tombstones == nil {
+		return fmt.Errorf("tombstones of %v are not kept", c.groupVersionKind)
+	}
+
+	obj, exists, err := c.tombstones.GetByKey(ObjectKeyToStoreKey(key))
 	if err != nil {
 		return err
 	}
+	return c.getObject(key, obj, exists, true, out)
+}
 
+func (c *ResourceInformer) getObject(key client.ObjectKey, obj interface{}, exists bool, deepCopy bool, out runtime.Object) error {
 	if !exists {
 		return errors.NewNotFound(schema.GroupResource{
 			Group:    c.groupVersionKind.Group,
@@ -50,7 +189,9 @@ func (c *ResourceInformer) Get(_ context.Context, key client.ObjectKey, out runt
 		return fmt.Errorf("cache contained %T, which is not an Object", obj)
 	}
 
-	obj = obj.(runtime.Object).DeepCopyObject()
+	if deepCopy {
+		obj = obj.(runtime.Object).DeepCopyObject()
+	}
 	outVal := reflect.ValueOf(out)
 	objVal := reflect.ValueOf(obj)
 	if !objVal.Type().AssignableTo(outVal.Type()) {
@@ -60,6 +201,21 @@ func (c *ResourceInformer) Get(_ context.Context, key client.ObjectKey, out runt
 	return nil
 }
 
+// keepTombstones keeps the last state of deleted objects for ttl, it
+// should be called before the informer runs
+func (c *ResourceInformer) keepTombstones(ttl time.Duration) {
+	c.tombstones = cache.NewTTLStore(cache.MetaNamespaceKeyFunc, ttl)
+	c.tombstoneTTL = ttl
+	c.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			c.tombstones.Add(obj)
+		},
+	})
+}
+
 func (c *ResourceInformer) List(ctx context.Context, opts *client.ListOptions, out runtime.Object) error {
 	var objs []interface{}
 	var err error
@@ -83,11 +239,41 @@ func (c *ResourceInformer) List(ctx context.Context, opts *client.ListOptions, o
 		labelSel = opts.LabelSelector
 	}
 
+	deepCopy := !c.disableDeepCopy
+	if opts != nil && opts.UnsafeDisableDeepCopy {
+		deepCopy = false
+	}
+
 	outItems, err := c.getListItems(objs, labelSel)
 	if err != nil {
 		return err
 	}
-	return apimeta.SetList(out, outItems)
+
+	sortItems(outItems, c.listLess)
+	var limit int64
+	var token string
+	if opts != nil {
+		limit, token = opts.Limit, opts.Continue
+	}
+	outItems, next, err := pageItems(outItems, c.listLess, limit, token)
+	if err != nil {
+		return err
+	}
+
+	if deepCopy {
+		for i, item := range outItems {
+			outItems[i] = item.DeepCopyObject()
+		}
+	}
+	if err := apimeta.SetList(out, outItems); err != nil {
+		return err
+	}
+	listMeta, err := apimeta.ListAccessor(out)
+	if err != nil {
+		return err
+	}
+	listMeta.SetContinue(next)
+	return nil
 }
 
 func (c *ResourceInformer) getListItems(objs []interface{}, labelSel labels.Selector) ([]runtime.Object, error) {
@@ -107,12 +293,13 @@ func (c *ResourceInformer) getListItems(objs []interface{}, labelSel labels.Sele
 				continue
 			}
 		}
-		outItems = append(outItems, obj.DeepCopyObject())
+		outItems = append(outItems, obj)
 	}
 	return outItems, nil
 }
 
-func objectKeyToStoreKey(k client.ObjectKey) string {
+// ObjectKeyToStoreKey returns the key of the object in the informer store
+func ObjectKeyToStoreKey(k client.ObjectKey) string {
 	if k.Namespace == "" {
 		return k.Name
 	}
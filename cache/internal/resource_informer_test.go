@@ -0,0 +1,246 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/client"
+)
+
+func newTestInformer(disableDeepCopy bool, podCount int) *ResourceInformer {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Pod{}, 0, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	for i := 0; i < podCount; i++ {
+		informer.GetIndexer().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("pod-%d", i),
+				Namespace: "default",
+				Labels:    map[string]string{"app": "nginx"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx"}}},
+		})
+	}
+	return newResourceCache(informer, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, disableDeepCopy)
+}
+
+func TestDeepCopyRead(t *testing.T) {
+	c := newTestInformer(false, 1)
+	pod := &corev1.Pod{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "pod-0"}, pod)
+	ut.Assert(t, err == nil, "get pod failed:%v", err)
+	pod.Labels["app"] = "changed"
+	pod.Spec.Containers[0].Image = "changed"
+
+	pods := &corev1.PodList{}
+	err = c.List(context.TODO(), nil, pods)
+	ut.Assert(t, err == nil, "list pod failed:%v", err)
+	ut.Equal(t, len(pods.Items), 1)
+	ut.Equal(t, pods.Items[0].Labels["app"], "nginx")
+	ut.Equal(t, pods.Items[0].Spec.Containers[0].Image, "nginx")
+}
+
+func TestUnsafeDisableDeepCopyRead(t *testing.T) {
+	c := newTestInformer(true, 1)
+	cached, _, _ := c.GetIndexer().GetByKey("default/pod-0")
+	cachedPod := cached.(*corev1.Pod)
+
+	pod := &corev1.Pod{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "pod-0"}, pod)
+	ut.Assert(t, err == nil, "get pod failed:%v", err)
+	ut.Assert(t, &pod.Spec.Containers[0] == &cachedPod.Spec.Containers[0], "get should share the cached containers")
+
+	c = newTestInformer(false, 1)
+	cached, _, _ = c.GetIndexer().GetByKey("default/pod-0")
+	cachedPod = cached.(*corev1.Pod)
+	pods := &corev1.PodList{}
+	err = c.List(context.TODO(), client.UnsafeReadOnly(), pods)
+	ut.Assert(t, err == nil, "list pod failed:%v", err)
+	ut.Equal(t, len(pods.Items), 1)
+	ut.Assert(t, &pods.Items[0].Spec.Containers[0] == &cachedPod.Spec.Containers[0], "list should share the cached containers")
+}
+
+// run with -race, unsafe reads must never write to the shared objects
+func TestUnsafeDisableDeepCopyConcurrentRead(t *testing.T) {
+	podCount := 100
+	c := newTestInformer(true, podCount)
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				pods := &corev1.PodList{}
+				if err := c.List(context.TODO(), client.InNamespace("default").MatchingLabels(map[string]string{"app": "nginx"}), pods); err != nil {
+					errCh <- err
+					return
+				} else if len(pods.Items) != podCount {
+					errCh <- fmt.Errorf("expect %d pods but get %d", podCount, len(pods.Items))
+					return
+				}
+
+				pod := &corev1.Pod{}
+				key := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("pod-%d", (i+j)%podCount)}
+				if err := c.Get(context.TODO(), key, pod); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		ut.Assert(t, err == nil, "concurrent read failed:%v", err)
+	}
+}
+
+func TestStopInformer(t *testing.T) {
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	informer := cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{})
+	c := newResourceCache(informer, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, false)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	ut.Assert(t, cache.WaitForCacheSync(stop, c.HasSynced), "informer should sync")
+
+	c.Stop()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("informer isn't stopped")
+	}
+
+	c = newResourceCache(informer, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, false)
+	c.Stop()
+	c.Run(stop)
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("informer stopped before run should be done")
+	}
+}
+
+func TestInformerStatus(t *testing.T) {
+	c := newTestInformer(false, 3)
+	status := c.Status()
+	ut.Equal(t, status.ObjectCount, 3)
+	ut.Assert(t, !status.Synced, "informer never ran shouldn't be synced")
+	ut.Assert(t, status.LastError == nil, "no error should be recorded")
+
+	err := fmt.Errorf("pods is forbidden")
+	c.setLastError(err)
+	status = c.Status()
+	ut.Equal(t, status.LastError, err)
+	ut.Assert(t, !status.LastErrorTime.IsZero(), "error time should be recorded")
+}
+
+func TestListOrderAndPaging(t *testing.T) {
+	c := newTestInformer(false, 25)
+	var names []string
+	token := ""
+	for {
+		pods := &corev1.PodList{}
+		err := c.List(context.TODO(), client.LimitTo(10).ContinueFrom(token), pods)
+		ut.Assert(t, err == nil, "list pod failed:%v", err)
+		for _, pod := range pods.Items {
+			names = append(names, pod.Name)
+		}
+		token = pods.Continue
+		if token == "" {
+			break
+		}
+		ut.Equal(t, len(pods.Items), 10)
+	}
+	ut.Equal(t, len(names), 25)
+	ut.Equal(t, names[0], "pod-0")
+	ut.Equal(t, names[1], "pod-1")
+	ut.Equal(t, names[2], "pod-10")
+	ut.Equal(t, names[24], "pod-9")
+
+	//resume after an item which is deleted
+	pods := &corev1.PodList{}
+	c.List(context.TODO(), client.LimitTo(2), pods)
+	c.GetIndexer().Delete(&pods.Items[1])
+	err := c.List(context.TODO(), client.LimitTo(1).ContinueFrom(pods.Continue), pods)
+	ut.Assert(t, err == nil, "list pod failed:%v", err)
+	ut.Equal(t, pods.Items[0].Name, "pod-10")
+
+	c.listLess = func(a, b runtime.Object) bool {
+		return a.(*corev1.Pod).Name > b.(*corev1.Pod).Name
+	}
+	pods = &corev1.PodList{}
+	err = c.List(context.TODO(), client.LimitTo(2), pods)
+	ut.Assert(t, err == nil, "list pod failed:%v", err)
+	ut.Equal(t, pods.Items[0].Name, "pod-9")
+	ut.Equal(t, pods.Items[1].Name, "pod-8")
+	err = c.List(context.TODO(), client.LimitTo(1).ContinueFrom(pods.Continue), pods)
+	ut.Assert(t, err == nil, "list pod failed:%v", err)
+	ut.Equal(t, pods.Items[0].Name, "pod-7")
+
+	err = c.List(context.TODO(), client.ContinueFrom("invalid"), pods)
+	ut.Assert(t, err != nil, "list with invalid token should fail")
+
+	ut.Assert(t, IsCacheContinueToken(pods.Continue), "token of the cache should be recognized")
+	apiServerToken := base64.RawURLEncoding.EncodeToString([]byte(`{"v":"meta.k8s.io/v1","rv":10,"start":"default/pod-1\u0000"}`))
+	ut.Assert(t, !IsCacheContinueToken(apiServerToken), "token of the API server shouldn't be taken as one of the cache")
+	err = c.List(context.TODO(), client.ContinueFrom(apiServerToken), pods)
+	ut.Assert(t, err != nil, "list with token of the API server should fail")
+}
+
+func TestTombstone(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default", ResourceVersion: "1"}}
+	fw := watch.NewFake()
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{Items: []corev1.Pod{*pod}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return fw, nil
+		},
+	}
+	c := newResourceCache(cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{}), schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, false)
+	c.keepTombstones(time.Minute)
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	ut.Assert(t, cache.WaitForCacheSync(stop, c.HasSynced), "informer should sync")
+
+	key := client.ObjectKey{Namespace: "default", Name: "pod-1"}
+	err := c.GetDeleted(context.TODO(), key, &corev1.Pod{})
+	ut.Assert(t, errors.IsNotFound(err), "pod isn't deleted yet")
+
+	deleted := pod.DeepCopy()
+	deleted.ResourceVersion = "2"
+	fw.Delete(deleted)
+	out := &corev1.Pod{}
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return c.GetDeleted(context.TODO(), key, out) == nil, nil
+	})
+	ut.Assert(t, err == nil, "deleted pod should be kept")
+	ut.Equal(t, out.ResourceVersion, "2")
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// kindSnapshot is the content of one informer store, saved as a list
+// object, ResourceVersion is where the watch resumes after warm start
+type kindSnapshot struct {
+	GVK             schema.GroupVersionKind `json:"gvk"`
+	ResourceVersion string                  `json:"resourceVersion"`
+	List            json.RawMessage         `json:"list"`
+}
+
+// snapshot is only loaded by a map of the same namespace
+type snapshot struct {
+	Namespace string         `json:"namespace"`
+	Kinds     []kindSnapshot `json:"kinds"`
+}
+
+// LoadSnapshot enables saving the stores to path when the map is stopped,
+// and preloads the informers created later with the snapshot saved in path
+// last time. Informers preloaded skip the first list and watch from the
+// saved resource version, if it's too old the informer falls back to a
+// full relist. A missing snapshot, or one which is corrupt or saved by a
+// map of another namespace, just means no warm start.
+func (m *InformersMap) LoadSnapshot(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshotPath = path
+	m.snapshots = make(map[schema.GroupVersionKind]*kindSnapshot)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		log.Printf("ignore corrupt cache snapshot %s: %v\n", path, err)
+		return nil
+	}
+	if s.Namespace != m.namespace {
+		log.Printf("ignore cache snapshot %s of namespace %q, the cache is of namespace %q\n", path, s.Namespace, m.namespace)
+		return nil
+	}
+	for i, k := range s.Kinds {
+		m.snapshots[k.GVK] = &s.Kinds[i]
+	}
+	return nil
+}
+
+// popSnapshot returns the saved snapshot of gvk, each snapshot is used once
+func (m *InformersMap) popSnapshot(gvk schema.GroupVersionKind) *kindSnapshot {
+	s, ok := m.snapshots[gvk]
+	if ok {
+		delete(m.snapshots, gvk)
+	}
+	return s
+}
+
+func (m *InformersMap) saveSnapshot() error {
+	m.mu.RLock()
+	s := snapshot{Namespace: m.namespace}
+	for gvk, c := range m.informersByGVK {
+		if !c.HasSynced() {
+			continue
+		}
+		k, err := m.newKindSnapshot(gvk, c)
+		if err != nil {
+			m.mu.RUnlock()
+			return err
+		}
+		s.Kinds = append(s.Kinds, *k)
+	}
+	m.mu.RUnlock()
+
+	data, err := json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.snapshotPath), filepath.Base(m.snapshotPath))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.snapshotPath)
+}
+
+func (m *InformersMap) newKindSnapshot(gvk schema.GroupVersionKind, c *ResourceInformer) (*kindSnapshot, error) {
+	list, err := m.Scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return nil, err
+	}
+
+	objs := c.GetStore().List()
+	items := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, obj.(runtime.Object))
+	}
+	if err := apimeta.SetList(list, items); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return &kindSnapshot{
+		GVK:             gvk,
+		ResourceVersion: c.LastSyncResourceVersion(),
+		List:            data,
+	}, nil
+}
+
+// decode returns the list object saved in the snapshot, listObj decides
+// the type of the list
+func (k *kindSnapshot) decode(listObj runtime.Object) (runtime.Object, error) {
+	list := listObj.DeepCopyObject()
+	if err := json.Unmarshal(k.List, list); err != nil {
+		return nil, err
+	}
+	listMeta, err := apimeta.ListAccessor(list)
+	if err != nil {
+		return nil, err
+	}
+	listMeta.SetResourceVersion(k.ResourceVersion)
+	return list, nil
+}
+
+// warmStartListFunc serves the first list from warmStart, and falls back to
+// list if there is no snapshot or it can't be decoded
+func warmStartListFunc(warmStart *kindSnapshot, listObj runtime.Object, list cache.ListFunc) cache.ListFunc {
+	//the reflector calls list sequentially, so it's safe to consume the
+	//snapshot without lock
+	return func(opts metav1.ListOptions) (runtime.Object, error) {
+		if warmStart != nil {
+			res, err := warmStart.decode(listObj)
+			gvk := warmStart.GVK
+			warmStart = nil
+			if err == nil {
+				return res, nil
+			}
+			log.Printf("ignore cache snapshot of %v: %v\n", gvk, err)
+		}
+		return list(opts)
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+
+	ut "github.com/cloudlinker/cement/unittest"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	ut.Assert(t, err == nil, "create temp dir failed:%v", err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{
+				ListMeta: metav1.ListMeta{ResourceVersion: "10"},
+				Items: []corev1.Pod{
+					{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default", ResourceVersion: "9"}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "pod-2", Namespace: "default", ResourceVersion: "10"}},
+				},
+			}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	c := newResourceCache(cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{}), gvk, false)
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	ut.Assert(t, cache.WaitForCacheSync(stop, c.HasSynced), "informer should sync")
+
+	m := NewInformersMap(nil, scheme.Scheme, nil, 0, "")
+	err = m.LoadSnapshot(path)
+	ut.Assert(t, err == nil, "load missing snapshot should succeed:%v", err)
+	m.informersByGVK[gvk] = c
+	err = m.saveSnapshot()
+	ut.Assert(t, err == nil, "save snapshot failed:%v", err)
+
+	m = NewInformersMap(nil, scheme.Scheme, nil, 0, "")
+	err = m.LoadSnapshot(path)
+	ut.Assert(t, err == nil, "load snapshot failed:%v", err)
+	s := m.popSnapshot(gvk)
+	ut.Assert(t, s != nil, "snapshot of pod should be loaded")
+	ut.Assert(t, m.popSnapshot(gvk) == nil, "snapshot should only be used once")
+
+	list, err := s.decode(&corev1.PodList{})
+	ut.Assert(t, err == nil, "decode snapshot failed:%v", err)
+	pods := list.(*corev1.PodList)
+	ut.Equal(t, pods.ResourceVersion, "10")
+	ut.Equal(t, len(pods.Items), 2)
+
+	m = NewInformersMap(nil, scheme.Scheme, nil, 0, "default")
+	err = m.LoadSnapshot(path)
+	ut.Assert(t, err == nil, "load snapshot of other namespace failed:%v", err)
+	ut.Assert(t, m.popSnapshot(gvk) == nil, "snapshot of other namespace shouldn't be loaded")
+
+	err = ioutil.WriteFile(path, []byte(`{"kinds":[`), 0644)
+	ut.Assert(t, err == nil, "write snapshot failed:%v", err)
+	m = NewInformersMap(nil, scheme.Scheme, nil, 0, "")
+	err = m.LoadSnapshot(path)
+	ut.Assert(t, err == nil, "corrupt snapshot should mean no warm start:%v", err)
+	ut.Assert(t, m.popSnapshot(gvk) == nil, "corrupt snapshot shouldn't be loaded")
+}
+
+// warmStartInformer runs an informer preloaded with snapshot, the live list
+// returns pod-3 at resource version 20, every watch started is sent to
+// watches
+type warmStartInformer struct {
+	*ResourceInformer
+	liveLists int32
+	watches   chan *startedWatch
+}
+
+type startedWatch struct {
+	resourceVersion string
+	fw              *watch.FakeWatcher
+}
+
+func newWarmStartInformer(snapshot *kindSnapshot) *warmStartInformer {
+	i := &warmStartInformer{watches: make(chan *startedWatch, 10)}
+	lw := &cache.ListWatch{
+		ListFunc: warmStartListFunc(snapshot, &corev1.PodList{}, func(metav1.ListOptions) (runtime.Object, error) {
+			atomic.AddInt32(&i.liveLists, 1)
+			return &corev1.PodList{
+				ListMeta: metav1.ListMeta{ResourceVersion: "20"},
+				Items: []corev1.Pod{
+					{ObjectMeta: metav1.ObjectMeta{Name: "pod-3", Namespace: "default", ResourceVersion: "20"}},
+				},
+			}, nil
+		}),
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			fw := watch.NewFake()
+			i.watches <- &startedWatch{resourceVersion: opts.ResourceVersion, fw: fw}
+			return fw, nil
+		},
+	}
+	i.ResourceInformer = newResourceCache(cache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, cache.Indexers{}), schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, false)
+	return i
+}
+
+func (i *warmStartInformer) nextWatch(t *testing.T) *startedWatch {
+	select {
+	case w := <-i.watches:
+		return w
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watch should be started")
+		return nil
+	}
+}
+
+func (i *warmStartInformer) keys() []string {
+	keys := i.GetStore().ListKeys()
+	sort.Strings(keys)
+	return keys
+}
+
+func TestWarmStartInformer(t *testing.T) {
+	data, err := json.Marshal(&corev1.PodList{
+		Items: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default", ResourceVersion: "9"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "pod-2", Namespace: "default", ResourceVersion: "10"}},
+		},
+	})
+	ut.Assert(t, err == nil, "marshal pod list failed:%v", err)
+	i := newWarmStartInformer(&kindSnapshot{ResourceVersion: "10", List: data})
+	stop := make(chan struct{})
+	defer close(stop)
+	go i.Run(stop)
+	ut.Assert(t, cache.WaitForCacheSync(stop, i.HasSynced), "informer should sync")
+
+	ut.Equal(t, atomic.LoadInt32(&i.liveLists), int32(0))
+	ut.Equal(t, i.keys(), []string{"default/pod-1", "default/pod-2"})
+	w := i.nextWatch(t)
+	ut.Equal(t, w.resourceVersion, "10")
+
+	//the saved resource version is too old, the informer relists
+	w.fw.Error(&metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusGone,
+		Reason:  metav1.StatusReasonExpired,
+		Message: "too old resource version",
+	})
+	w = i.nextWatch(t)
+	ut.Equal(t, w.resourceVersion, "20")
+	ut.Equal(t, atomic.LoadInt32(&i.liveLists), int32(1))
+	//the store is replaced asynchronously
+	wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return len(i.keys()) == 1, nil
+	})
+	ut.Equal(t, i.keys(), []string{"default/pod-3"})
+}
+
+func TestWarmStartInformerCorruptSnapshot(t *testing.T) {
+	i := newWarmStartInformer(&kindSnapshot{ResourceVersion: "10", List: json.RawMessage(`"corrupt"`)})
+	stop := make(chan struct{})
+	defer close(stop)
+	go i.Run(stop)
+	ut.Assert(t, cache.WaitForCacheSync(stop, i.HasSynced), "informer should sync")
+
+	ut.Equal(t, atomic.LoadInt32(&i.liveLists), int32(1))
+	ut.Equal(t, i.keys(), []string{"default/pod-3"})
+	ut.Equal(t, i.nextWatch(t).resourceVersion, "20")
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cloudlinker/kubecarve/metrics"
+)
+
+const (
+	readThroughNotStarted = "not_started"
+	readThroughNotSynced  = "not_synced"
+	readThroughNotFound   = "not_found"
+)
+
+var readThroughTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kubecarve_cache_read_through_total",
+	Help: "Total number of cache reads served by the API server, partitioned by kind and reason",
+}, []string{"kind", "reason"})
+
+var consistencyChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kubecarve_cache_consistency_checks_total",
+	Help: "Total number of consistency checks between the cache and the API server, partitioned by kind",
+}, []string{"kind"})
+
+var driftObjectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kubecarve_cache_drift_objects_total",
+	Help: "Total number of objects found drifted by consistency checks, partitioned by kind and drift type",
+}, []string{"kind", "type"})
+
+func init() {
+	metrics.Registry.MustRegister(readThroughTotal)
+	metrics.Registry.MustRegister(consistencyChecksTotal)
+	metrics.Registry.MustRegister(driftObjectsTotal)
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ Client = &delegatingClient{}
+
+// delegatingClient reads from reader, which is usually a cache, and writes
+// with client
+type delegatingClient struct {
+	Reader
+	Writer
+	StatusClient
+}
+
+// NewDelegatingClient returns a client which reads from reader and sends
+// writes and status updates to client
+func NewDelegatingClient(reader Reader, client Client) Client {
+	return &delegatingClient{
+		Reader:       reader,
+		Writer:       client,
+		StatusClient: client,
+	}
+}
+
+func (c *delegatingClient) Get(ctx context.Context, key ObjectKey, obj runtime.Object) error {
+	return c.Reader.Get(ctx, key, obj)
+}
+
+func (c *delegatingClient) List(ctx context.Context, opts *ListOptions, list runtime.Object) error {
+	return c.Reader.List(ctx, opts, list)
+}
@@ -70,6 +70,16 @@ type ListOptions struct {
 	FieldSelector fields.Selector
 	Namespace     string
 	Raw           *metav1.ListOptions
+
+	// Limit caps the number of items returned, the list gets a continue
+	// token if more items are left
+	Limit int64
+	// Continue is the token of a previous list to get its next page
+	Continue string
+
+	// UnsafeDisableDeepCopy only applies to cache reads, the listed items
+	// are the objects held by the informer and must be treated as read-only.
+	UnsafeDisableDeepCopy bool
 }
 
 func (o *ListOptions) SetLabelSelector(selRaw string) error {
@@ -103,6 +113,12 @@ func (o *ListOptions) AsListOptions() *metav1.ListOptions {
 	if o.FieldSelector != nil {
 		o.Raw.FieldSelector = o.FieldSelector.String()
 	}
+	if o.Limit > 0 {
+		o.Raw.Limit = o.Limit
+	}
+	if o.Continue != "" {
+		o.Raw.Continue = o.Continue
+	}
 	return o.Raw
 }
 
@@ -123,6 +139,24 @@ func (o *ListOptions) InNamespace(ns string) *ListOptions {
 	return o
 }
 
+// LimitTo returns at most limit items per list
+func (o *ListOptions) LimitTo(limit int64) *ListOptions {
+	o.Limit = limit
+	return o
+}
+
+// ContinueFrom lists the page after the one token is returned with
+func (o *ListOptions) ContinueFrom(token string) *ListOptions {
+	o.Continue = token
+	return o
+}
+
+// UnsafeReadOnly skips the DeepCopy of every item when listing from cache
+func (o *ListOptions) UnsafeReadOnly() *ListOptions {
+	o.UnsafeDisableDeepCopy = true
+	return o
+}
+
 func MatchingLabels(lbls map[string]string) *ListOptions {
 	return (&ListOptions{}).MatchingLabels(lbls)
 }
@@ -134,3 +168,15 @@ func MatchingField(name, val string) *ListOptions {
 func InNamespace(ns string) *ListOptions {
 	return (&ListOptions{}).InNamespace(ns)
 }
+
+func LimitTo(limit int64) *ListOptions {
+	return (&ListOptions{}).LimitTo(limit)
+}
+
+func ContinueFrom(token string) *ListOptions {
+	return (&ListOptions{}).ContinueFrom(token)
+}
+
+func UnsafeReadOnly() *ListOptions {
+	return (&ListOptions{}).UnsafeReadOnly()
+}
@@ -1,11 +1,18 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
 
@@ -15,66 +22,325 @@ import (
 	"github.com/cloudlinker/kubecarve/eventsource"
 	"github.com/cloudlinker/kubecarve/handler"
 	"github.com/cloudlinker/kubecarve/predicate"
+	"github.com/cloudlinker/kubecarve/reconcile"
 )
 
+// processFunc handles one item got from the queue
+type processFunc func(ctx context.Context, item interface{}) (reconcile.Result, error)
+
+// source is the event channel of a watched kind, the events passing the
+// predicates are mapped to reconcile requests if mapper is set, otherwise
+// they are queued as watchEvent and passed to handler
+type source struct {
+	gvk         schema.GroupVersionKind
+	eventSource eventsource.EventSource
+	events      <-chan interface{}
+	mapper      handler.RequestMapper
+	handler     handler.ContextEventHandler
+	predicates  []predicate.Predicate
+}
+
+// watchEvent is the item queued by event controllers, the handler is
+// looked up by gvk when the event is processed
+type watchEvent struct {
+	gvk   schema.GroupVersionKind
+	event interface{}
+}
+
+type Options struct {
+	// MaxConcurrentReconciles is the number of workers processing the
+	// queue, default is 1. The queue never hands an item to two workers at
+	// the same time. The events of one object are queued as one item, so
+	// they are handled in the order they arrive by one worker at a time,
+	// and a failed event is retried before the later events of its object.
+	MaxConcurrentReconciles int
+	// RePanic makes workers panic again after logging a recovered panic,
+	// by default the panicking item is requeued with backoff
+	RePanic bool
+	// EventTimeout bounds the context passed to each handler or reconciler
+	// call, zero means no bound
+	EventTimeout time.Duration
+	// GracePeriod is how long Start waits for the in-flight calls after
+	// stop, their contexts are cancelled when it passes and Start returns
+	// an error. If it's zero, the contexts are cancelled on stop and Start
+	// waits until the calls return.
+	GracePeriod time.Duration
+	// RateLimiter delays the retries, DefaultRateLimiter is used if nil
+	RateLimiter RateLimiter
+	// MaxRetries is how many times an item is retried on error before it's
+	// given up, zero means no limit. A requeue asked by a successful call
+	// starts the count over.
+	MaxRetries int
+	// OnGiveUp is called with the event or request given up and its last
+	// error
+	OnGiveUp func(item interface{}, err error)
+}
+
+// controller is shared by event controllers and reconcile controllers,
+// they differ in what is queued and how a queued item is processed
 type controller struct {
-	name       string
-	handler    handler.EventHandler
-	predicates []predicate.Predicate
-	cache      cache.Cache
-	sources    map[schema.GroupVersionKind]<-chan interface{}
-	queue      workqueue.RateLimitingInterface
-	scheme     *runtime.Scheme
+	name  string
+	cache cache.Cache
+	queue workqueue.RateLimitingInterface
+	// rateLimiter is the one of queue
+	rateLimiter RateLimiter
+	scheme      *runtime.Scheme
+	workers     int
+	rePanic     bool
+	timeout     time.Duration
+	grace       time.Duration
+	done        chan struct{}
+
+	maxRetries int
+	onGiveUp   func(item interface{}, err error)
+	// failures counts the failures of each item until it's forgotten
+	failuresMu sync.Mutex
+	failures   map[interface{}]int
+
+	// inFlight records when each item under processing was started, it
+	// has its own lock so probes never wait for Watch or Unwatch
+	inFlightMu sync.Mutex
+	inFlight   map[interface{}]time.Time
+
+	// pending holds the events of each object queued by its key, the
+	// head is the event to process next
+	pendingMu sync.Mutex
+	pending   map[objectKey][]watchEvent
+
+	mu      sync.Mutex
+	started bool
+	sources map[schema.GroupVersionKind]*source
+	// eventSources are kept after Unwatch, a kind watched again reuses
+	// the handler registered with its informer
+	eventSources map[schema.GroupVersionKind]eventsource.EventSource
+	// once collecting, sources watched later are passed to the collector
+	// through newSources
+	collecting bool
+	newSources chan *source
+	stop       <-chan struct{}
 }
 
-func New(name string, cache cache.Cache, scheme *runtime.Scheme) Controller {
+func newController(name string, cache cache.Cache, scheme *runtime.Scheme, opts Options) *controller {
+	workers := opts.MaxConcurrentReconciles
+	if workers <= 0 {
+		workers = 1
+	}
+	rateLimiter := opts.RateLimiter
+	if rateLimiter == nil {
+		rateLimiter = DefaultRateLimiter()
+	}
 	return &controller{
-		name:    name,
-		cache:   cache,
-		sources: make(map[schema.GroupVersionKind]<-chan interface{}),
-		scheme:  scheme,
+		name:         name,
+		cache:        cache,
+		queue:        workqueue.NewNamedRateLimitingQueue(rateLimiter, name),
+		rateLimiter:  rateLimiter,
+		scheme:       scheme,
+		workers:      workers,
+		rePanic:      opts.RePanic,
+		timeout:      opts.EventTimeout,
+		grace:        opts.GracePeriod,
+		done:         make(chan struct{}),
+		inFlight:     make(map[interface{}]time.Time),
+		pending:      make(map[objectKey][]watchEvent),
+		failures:     make(map[interface{}]int),
+		maxRetries:   opts.MaxRetries,
+		onGiveUp:     opts.OnGiveUp,
+		sources:      make(map[schema.GroupVersionKind]*source),
+		eventSources: make(map[schema.GroupVersionKind]eventsource.EventSource),
+		newSources:   make(chan *source),
 	}
 }
 
-func (c *controller) Watch(obj runtime.Object) error {
+// addSource fills the event channel of s and starts collecting its events
+func (c *controller) addSource(obj runtime.Object, s *source) error {
 	gvk, err := apiutil.GVKForObject(obj, c.scheme)
 	if err != nil {
 		return err
 	}
 
+	c.mu.Lock()
+	es, ok := c.eventSources[gvk]
+	if ok {
+		delete(c.eventSources, gvk)
+	} else {
+		es = eventsource.New(gvk, c.cache)
+	}
+	c.mu.Unlock()
+	return c.watchSource(gvk, es, s)
+}
+
+// watchSource reserves the kind before getting the event channel, which
+// may wait for a new informer to sync, so the lock isn't held meanwhile
+func (c *controller) watchSource(gvk schema.GroupVersionKind, es eventsource.EventSource, s *source) error {
+	s.gvk = gvk
+	s.eventSource = es
+	c.mu.Lock()
 	if _, ok := c.sources[gvk]; ok {
+		c.releaseEventSource(gvk, es)
+		c.mu.Unlock()
 		return fmt.Errorf("watch obj %v more than once", gvk)
 	}
+	c.sources[gvk] = s
+	c.mu.Unlock()
+
+	ch, err := es.GetEventChannel()
 
-	ch, err := eventsource.New(gvk, c.cache).GetEventChannel()
+	c.mu.Lock()
+	if c.sources[gvk] != s {
+		c.mu.Unlock()
+		if err == nil {
+			es.Stop()
+		}
+		c.mu.Lock()
+		c.releaseEventSource(gvk, es)
+		c.mu.Unlock()
+		return fmt.Errorf("obj %v is unwatched before its events are ready", gvk)
+	}
 	if err != nil {
+		delete(c.sources, gvk)
+		c.releaseEventSource(gvk, es)
+		c.mu.Unlock()
 		return err
 	}
+	s.events = ch
+	collecting, stop := c.collecting, c.stop
+	c.mu.Unlock()
 
-	c.sources[gvk] = ch
+	if collecting {
+		select {
+		case c.newSources <- s:
+		case <-stop:
+		}
+	}
+	return nil
+}
+
+// releaseEventSource keeps es for the next Watch of the kind, an event
+// source is used by one Watch at a time. If the kind is watched again
+// before es is released, es is dropped with its handler left in the
+// informer. It's called with the lock held.
+func (c *controller) releaseEventSource(gvk schema.GroupVersionKind, es eventsource.EventSource) {
+	if _, ok := c.eventSources[gvk]; !ok {
+		c.eventSources[gvk] = es
+	}
+}
+
+// removeSource detaches the source of obj from its informer, the collector
+// drops the source once its event channel is closed
+func (c *controller) removeSource(obj runtime.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return err
+	}
+	return c.unwatchSource(gvk)
+}
+
+func (c *controller) unwatchSource(gvk schema.GroupVersionKind) error {
+	c.mu.Lock()
+	s, ok := c.sources[gvk]
+	delete(c.sources, gvk)
+	//a source whose events aren't ready is released by its Watch
+	ready := s != nil && s.events != nil
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("obj %v isn't watched", gvk)
+	}
+	if ready {
+		s.eventSource.Stop()
+		c.mu.Lock()
+		c.releaseEventSource(gvk, s.eventSource)
+		c.mu.Unlock()
+	}
 	return nil
 }
 
-func (c *controller) Start(stop <-chan struct{}, handler handler.EventHandler, predicates ...predicate.Predicate) {
-	c.handler = handler
-	c.predicates = predicates
-	c.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), c.name)
+// dropSource forgets s whose event channel is closed, like when its
+// informer is removed from the cache, unless the kind is watched again
+func (c *controller) dropSource(s *source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sources[s.gvk] == s {
+		delete(c.sources, s.gvk)
+		c.releaseEventSource(s.gvk, s.eventSource)
+	}
+}
+
+// run returns once the collector and workers exit after stop, items left
+// in the queue are dropped
+func (c *controller) run(stop <-chan struct{}, process processFunc) error {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return fmt.Errorf("controller %s is already started", c.name)
+	}
+	c.started = true
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	var wg wait.Group
 	wg.StartWithChannel(stop, c.collectEvent)
-	wg.StartWithChannel(stop, c.processEvent)
-	wg.Wait()
+	for i := 0; i < c.workers; i++ {
+		wg.StartWithChannel(stop, func(stop <-chan struct{}) {
+			c.processEvent(ctx, stop, process)
+		})
+	}
+
+	<-stop
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+		close(c.done)
+	}()
+
+	if c.grace == 0 {
+		cancel()
+		<-finished
+		return nil
+	}
+
+	select {
+	case <-finished:
+		return nil
+	case <-time.After(c.grace):
+		return fmt.Errorf("controller %s still has in-flight events after %v", c.name, c.grace)
+	}
 }
 
+// Done is closed when the workers exit after stop, it may be closed after
+// Start returns if the in-flight events exceed the grace period
+func (c *controller) Done() <-chan struct{} {
+	return c.done
+}
+
+// collectEvent selects on the event channels of all sources, followed by
+// newSources and stop
 func (c *controller) collectEvent(stop <-chan struct{}) {
-	cases := make([]reflect.SelectCase, 0, len(c.sources)+1)
-	for _, ch := range c.sources {
+	c.mu.Lock()
+	sources := make([]*source, 0, len(c.sources))
+	cases := make([]reflect.SelectCase, 0, len(c.sources)+2)
+	for _, s := range c.sources {
+		//reserved sources are passed through newSources once ready
+		if s.events == nil {
+			continue
+		}
+		sources = append(sources, s)
 		cases = append(cases, reflect.SelectCase{
 			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(ch),
+			Chan: reflect.ValueOf(s.events),
 		})
 	}
+	c.collecting = true
+	c.stop = stop
+	c.mu.Unlock()
+
 	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(c.newSources),
+	}, reflect.SelectCase{
 		Dir:  reflect.SelectRecv,
 		Chan: reflect.ValueOf(stop),
 	})
@@ -86,76 +352,372 @@ func (c *controller) collectEvent(stop <-chan struct{}) {
 			return
 		}
 
+		if i == len(cases)-2 {
+			s := e.Interface().(*source)
+			sources = append(sources, s)
+			cases = append(cases[:i], reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(s.events),
+			}, cases[i], cases[i+1])
+			continue
+		}
+
 		if !ok {
+			c.dropSource(sources[i])
 			cases = append(cases[:i], cases[i+1:]...)
+			sources = append(sources[:i], sources[i+1:]...)
 			continue
 		}
 
-		c.queue.Add(e.Interface())
+		s, evt := sources[i], e.Interface()
+		if s.ignore(evt) {
+			continue
+		}
+		if s.mapper == nil {
+			c.addEvent(watchEvent{gvk: s.gvk, event: evt})
+			continue
+		}
+		for _, req := range s.requests(evt) {
+			c.queue.Add(req)
+		}
+	}
+}
+
+// ignore checks the event with the predicates of the source
+func (s *source) ignore(e interface{}) bool {
+	for _, p := range s.predicates {
+		switch e := e.(type) {
+		case event.CreateEvent:
+			if p.IgnoreCreate(e) {
+				return true
+			}
+		case event.UpdateEvent:
+			if p.IgnoreUpdate(e) {
+				return true
+			}
+		case event.DeleteEvent:
+			if p.IgnoreDelete(e) {
+				return true
+			}
+		case event.GenericEvent:
+			if p.IgnoreGeneric(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *source) requests(e interface{}) []reconcile.Request {
+	switch e := e.(type) {
+	case event.CreateEvent:
+		return s.mapper.MapCreate(e)
+	case event.UpdateEvent:
+		return s.mapper.MapUpdate(e)
+	case event.DeleteEvent:
+		return s.mapper.MapDelete(e)
+	case event.GenericEvent:
+		return s.mapper.MapGeneric(e)
+	default:
+		return nil
 	}
 }
 
-func (c *controller) processEvent(stop <-chan struct{}) {
+func (c *controller) eventHandler(gvk schema.GroupVersionKind) handler.ContextEventHandler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.sources[gvk]; ok {
+		return s.handler
+	}
+	return nil
+}
+
+func (c *controller) processEvent(ctx context.Context, stop <-chan struct{}, process processFunc) {
 	for {
 		select {
 		case <-stop:
 			return
 		default:
 		}
-		c.processNextEvent()
+		c.processNextEvent(ctx, stop, process)
 	}
 }
 
-func (c *controller) processNextEvent() {
+func (c *controller) processNextEvent(ctx context.Context, stop <-chan struct{}, process processFunc) {
 	o, shutdown := c.queue.Get()
 	if shutdown {
 		return
 	}
 	defer c.queue.Done(o)
 
+	//the shutting down queue still hands out the queued items
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
 	if o == nil {
 		c.queue.Forget(o)
 		return
 	}
 
-	var err error
-	var result handler.Result
-	switch e := o.(type) {
-	case event.CreateEvent:
-		for _, p := range c.predicates {
-			if p.IgnoreCreate(e) {
-				return
+	key, ok := o.(objectKey)
+	if !ok {
+		c.processQueued(ctx, process, o, o)
+		return
+	}
+	we, ok := c.headEvent(key)
+	if !ok {
+		c.forget(key)
+		return
+	}
+	if c.processQueued(ctx, process, key, we) && c.popEvent(key) {
+		c.queue.Add(key)
+	}
+}
+
+// processQueued processes o which is queued as item, and requeues item,
+// forgets it or gives it up by the result. It returns whether o is done
+// with, false means o is to be processed again
+func (c *controller) processQueued(ctx context.Context, process processFunc, item, o interface{}) bool {
+	workers := activeWorkers.WithLabelValues(c.name)
+	workers.Inc()
+	start := time.Now()
+	c.setInFlight(o, start)
+	result, err := c.processItem(ctx, process, o)
+	c.setInFlight(o, time.Time{})
+	observeProcess(c.name, o, start, result, err)
+	workers.Dec()
+
+	if err != nil {
+		if handler.IsTerminalError(err) {
+			log.Printf("controller %s drops %v: %v\n", c.name, o, err)
+			c.forget(item)
+		} else if c.maxRetries > 0 && c.fail(item) > c.maxRetries {
+			log.Printf("controller %s gives up %v after %d retries: %v\n", c.name, o, c.maxRetries, err)
+			c.forget(item)
+			if c.onGiveUp != nil {
+				c.onGiveUp(unwrapItem(o), err)
 			}
+		} else {
+			c.queue.AddRateLimited(item)
+			return false
 		}
-		result, err = c.handler.OnCreate(e)
+	} else if result.RequeueAfter > 0 {
+		c.forget(item)
+		c.queue.AddAfter(item, result.RequeueAfter)
+		return false
+	} else if result.Requeue {
+		c.requeue(item)
+		return false
+	} else {
+		c.forget(item)
+	}
+	return true
+}
+
+// fail records one more failure of o and returns how many times o failed
+// since it's forgotten, the rate limiter can't tell it, a bucket limiter
+// doesn't track items
+func (c *controller) fail(o interface{}) int {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+	c.failures[o] += 1
+	return c.failures[o]
+}
+
+// forget clears the failures of o and its backoff
+func (c *controller) forget(o interface{}) {
+	c.failuresMu.Lock()
+	delete(c.failures, o)
+	c.failuresMu.Unlock()
+	c.queue.Forget(o)
+}
+
+// objectKey identifies the object of a watch event
+type objectKey struct {
+	gvk schema.GroupVersionKind
+	types.NamespacedName
+}
+
+// eventObjectKey returns the key of the object we is about
+func eventObjectKey(we watchEvent) (objectKey, bool) {
+	var meta metav1.Object
+	switch e := we.event.(type) {
+	case event.CreateEvent:
+		meta = e.Meta
 	case event.UpdateEvent:
-		for _, p := range c.predicates {
-			if p.IgnoreUpdate(e) {
-				return
-			}
-		}
-		result, err = c.handler.OnUpdate(e)
+		meta = e.MetaNew
 	case event.DeleteEvent:
-		for _, p := range c.predicates {
-			if p.IgnoreDelete(e) {
-				return
-			}
-		}
-		result, err = c.handler.OnDelete(e)
+		meta = e.Meta
 	case event.GenericEvent:
-		result, err = c.handler.OnGeneric(e)
+		meta = e.Meta
+	}
+	if meta == nil {
+		return objectKey{}, false
+	}
+	return objectKey{
+		gvk:            we.gvk,
+		NamespacedName: types.NamespacedName{Namespace: meta.GetNamespace(), Name: meta.GetName()},
+	}, true
+}
 
-	default:
-		panic(fmt.Sprintf("unkown event [%v]", reflect.TypeOf(o).Name()))
+// addEvent appends we to the pending events of its object and queues the
+// object, an event without an object is queued by itself
+func (c *controller) addEvent(we watchEvent) {
+	key, ok := eventObjectKey(we)
+	if !ok {
+		c.queue.Add(we)
+		return
 	}
+	c.pendingMu.Lock()
+	c.pending[key] = append(c.pending[key], we)
+	c.pendingMu.Unlock()
+	c.queue.Add(key)
+}
 
-	if err != nil {
-		c.queue.AddRateLimited(o)
-	} else if result.RequeueAfter > 0 {
-		c.queue.AddAfter(o, result.RequeueAfter)
-	} else if result.Requeue {
-		c.queue.AddRateLimited(o)
+// headEvent returns the next event of the object
+func (c *controller) headEvent(key objectKey) (watchEvent, bool) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	events := c.pending[key]
+	if len(events) == 0 {
+		return watchEvent{}, false
+	}
+	return events[0], true
+}
+
+// popEvent removes the head event of the object and returns whether the
+// object has more events
+func (c *controller) popEvent(key objectKey) bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	events := c.pending[key]
+	if len(events) <= 1 {
+		delete(c.pending, key)
+		return false
+	}
+	c.pending[key] = events[1:]
+	return true
+}
+
+// requeue adds o back after a successful call asks for it, o waits as if
+// it failed the first time, but it isn't counted toward MaxRetries
+func (c *controller) requeue(o interface{}) {
+	c.forget(o)
+	delay := c.rateLimiter.When(o)
+	c.rateLimiter.Forget(o)
+	c.queue.AddAfter(o, delay)
+}
+
+// setInFlight records o is being processed since start, a zero start
+// clears the record
+func (c *controller) setInFlight(o interface{}, start time.Time) {
+	c.inFlightMu.Lock()
+	defer c.inFlightMu.Unlock()
+	if start.IsZero() {
+		delete(c.inFlight, o)
 	} else {
-		c.queue.Forget(o)
+		c.inFlight[o] = start
+	}
+}
+
+// OldestInFlight returns how long the item processed for the longest time
+// has been processed, zero if no item is being processed
+func (c *controller) OldestInFlight() time.Duration {
+	c.inFlightMu.Lock()
+	defer c.inFlightMu.Unlock()
+	var oldest time.Duration
+	for _, start := range c.inFlight {
+		if d := time.Since(start); d > oldest {
+			oldest = d
+		}
+	}
+	return oldest
+}
+
+// unwrapItem returns the event of a watchEvent, other items are returned
+// as they are
+func unwrapItem(o interface{}) interface{} {
+	if we, ok := o.(watchEvent); ok {
+		return we.event
+	}
+	return o
+}
+
+// processItem turns a panic of process into an error
+func (c *controller) processItem(ctx context.Context, process processFunc, o interface{}) (result reconcile.Result, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("controller %s panics when processing %v: %v\n%s", c.name, o, r, debug.Stack())
+			if c.rePanic {
+				panic(r)
+			}
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return process(ctx, o)
+}
+
+// eventController queues the events of every watched kind and passes them
+// to the event handler of the kind
+type eventController struct {
+	*controller
+}
+
+func New(name string, cache cache.Cache, scheme *runtime.Scheme, opts Options) Controller {
+	return &eventController{
+		controller: newController(name, cache, scheme, opts),
+	}
+}
+
+func (c *eventController) Watch(obj runtime.Object, h handler.ContextEventHandler, predicates ...predicate.Predicate) error {
+	if h == nil {
+		return fmt.Errorf("event handler is required")
+	}
+	return c.addSource(obj, &source{
+		handler:    h,
+		predicates: predicates,
+	})
+}
+
+func (c *eventController) Unwatch(obj runtime.Object) error {
+	return c.removeSource(obj)
+}
+
+func (c *eventController) Start(stop <-chan struct{}) error {
+	return c.run(stop, c.handleEvent)
+}
+
+func (c *eventController) handleEvent(ctx context.Context, o interface{}) (handler.Result, error) {
+	we, ok := o.(watchEvent)
+	if !ok {
+		return handler.Result{}, handler.TerminalError(fmt.Errorf("unknown event [%v]", reflect.TypeOf(o)))
+	}
+
+	//events of unwatched kinds are dropped
+	h := c.eventHandler(we.gvk)
+	if h == nil {
+		return handler.Result{}, nil
+	}
+
+	switch e := we.event.(type) {
+	case event.CreateEvent:
+		return h.OnCreate(ctx, e)
+	case event.UpdateEvent:
+		return h.OnUpdate(ctx, e)
+	case event.DeleteEvent:
+		return h.OnDelete(ctx, e)
+	case event.GenericEvent:
+		return h.OnGeneric(ctx, e)
+	default:
+		return handler.Result{}, handler.TerminalError(fmt.Errorf("unknown event [%v]", reflect.TypeOf(we.event)))
 	}
 }
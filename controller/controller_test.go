@@ -3,11 +3,13 @@ package controller
 import (
 	"context"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	ut "github.com/cloudlinker/cement/unittest"
@@ -16,6 +18,7 @@ import (
 	"github.com/cloudlinker/kubecarve/event"
 	"github.com/cloudlinker/kubecarve/handler"
 	"github.com/cloudlinker/kubecarve/predicate"
+	"github.com/cloudlinker/kubecarve/reconcile"
 	"github.com/cloudlinker/kubecarve/testenv"
 )
 
@@ -84,10 +87,11 @@ func TestController(t *testing.T) {
 	go c.Start(stop)
 	ut.Assert(t, c.WaitForCacheSync(stop), "wait for sync should ok")
 
-	ctrl := New("dumbController", c, scheme.Scheme)
-	ctrl.Watch(&corev1.Pod{})
-	handler := &dumbEventHandler{}
-	go ctrl.Start(stop, handler, predicate.NewIgnoreUnchangedUpdate())
+	ctrl := New("dumbController", c, scheme.Scheme, Options{})
+	h := &dumbEventHandler{}
+	err = ctrl.Watch(&corev1.Pod{}, handler.AdaptEventHandler(h), predicate.NewIgnoreUnchangedUpdate())
+	ut.Assert(t, err == nil, "watch pod failed:%v", err)
+	go ctrl.Start(stop)
 
 	testNamespaceOne := "test-namespace-1"
 	testNamespaceTwo := "test-namespace-2"
@@ -100,26 +104,82 @@ func TestController(t *testing.T) {
 	ut.Assert(t, err == nil, "create pod failed:%v", err)
 
 	<-time.After(time.Second)
-	ut.Equal(t, handler.podCreateEvent, 3)
-	ut.Equal(t, handler.podUpdateEventCount, 0)
-	ut.Equal(t, handler.podDeleteEventCount, 0)
+	ut.Equal(t, h.podCreateEvent, 3)
+	ut.Equal(t, h.podUpdateEventCount, 0)
+	ut.Equal(t, h.podDeleteEventCount, 0)
 
 	pod1.Spec.Containers[0].Image = "nginxv2"
 	err = cli.Update(context.TODO(), pod1)
 	ut.Assert(t, err == nil, "update pod failed:%v", err)
 	<-time.After(time.Second)
-	ut.Equal(t, handler.podUpdateEventCount, 1)
+	ut.Equal(t, h.podUpdateEventCount, 1)
 
 	//nothing changed
 	err = cli.Update(context.TODO(), pod1)
 	ut.Assert(t, err == nil, "update pod failed:%v", err)
 	<-time.After(time.Second)
-	ut.Equal(t, handler.podUpdateEventCount, 1)
+	ut.Equal(t, h.podUpdateEventCount, 1)
 
 	err = cli.Delete(context.TODO(), pod1)
 	ut.Assert(t, err == nil, "delete pod failed:%v", err)
 	<-time.After(time.Second)
-	ut.Equal(t, handler.podDeleteEventCount, 1)
-	ut.Equal(t, handler.podUpdateEventCount, 2) //delete will cause update event
-	ut.Equal(t, handler.podCreateEvent, 3)
+	ut.Equal(t, h.podDeleteEventCount, 1)
+	ut.Equal(t, h.podUpdateEventCount, 2) //delete will cause update event
+	ut.Equal(t, h.podCreateEvent, 3)
+}
+
+type countReconciler struct {
+	mu       sync.Mutex
+	requests map[reconcile.Request]int
+}
+
+func (r *countReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[req] += 1
+	return reconcile.Result{}, nil
+}
+
+func (r *countReconciler) count(req reconcile.Request) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests[req]
+}
+
+func TestReconcileController(t *testing.T) {
+	env := testenv.NewEnv(os.Getenv("K8S_ASSETS"), nil)
+	err := env.Start()
+	ut.Assert(t, err == nil, "testenv cluster start failed:%v", err)
+	defer func() {
+		env.Stop()
+	}()
+
+	cli, err := client.New(env.Config, client.Options{})
+	ut.Assert(t, err == nil, "create client failed:%v", err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	c, err := cache.New(env.Config, cache.Options{})
+	ut.Assert(t, err == nil, "create cache failed:%v", err)
+	go c.Start(stop)
+	ut.Assert(t, c.WaitForCacheSync(stop), "wait for sync should ok")
+
+	reconciler := &countReconciler{requests: make(map[reconcile.Request]int)}
+	ctrl := NewReconcileController("countController", c, scheme.Scheme, reconciler, Options{MaxConcurrentReconciles: 2})
+	err = ctrl.Watch(&corev1.Pod{}, &handler.EnqueueRequestForObject{}, predicate.NewIgnoreUnchangedUpdate())
+	ut.Assert(t, err == nil, "watch pod failed:%v", err)
+	go ctrl.Start(stop)
+
+	pod := newPod("test-pod-1", "test-namespace-1", nil, corev1.RestartPolicyNever)
+	err = cli.Create(context.TODO(), pod)
+	ut.Assert(t, err == nil, "create pod failed:%v", err)
+	<-time.After(time.Second)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}
+	ut.Equal(t, reconciler.count(req), 1)
+
+	pod.Spec.Containers[0].Image = "nginxv2"
+	err = cli.Update(context.TODO(), pod)
+	ut.Assert(t, err == nil, "update pod failed:%v", err)
+	<-time.After(time.Second)
+	ut.Equal(t, reconciler.count(req), 2)
 }
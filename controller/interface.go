@@ -1,13 +1,37 @@
 package controller
 
 import (
+	"time"
+
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/cloudlinker/kubecarve/handler"
 	"github.com/cloudlinker/kubecarve/predicate"
 )
 
+// Controller passes the events of every watched kind to the handler of
+// the kind, all kinds share one queue and worker pool. Watch and Unwatch
+// are safe to call on a running controller, the events of an unwatched kind
+// are dropped. Informers can't remove handlers, so the handler of an
+// unwatched kind is kept and reused when the kind is watched again. Use
+// handler.AdaptEventHandler to watch with an EventHandler.
 type Controller interface {
-	Watch(obj runtime.Object) error
-	Start(stop <-chan struct{}, handler handler.EventHandler, predicates ...predicate.Predicate)
+	Watch(obj runtime.Object, handler handler.ContextEventHandler, predicates ...predicate.Predicate) error
+	Unwatch(obj runtime.Object) error
+	// Start blocks until stop is closed and the in-flight events are done
+	Start(stop <-chan struct{}) error
+	Done() <-chan struct{}
+	// OldestInFlight tells how long the longest running handler call has
+	// been running, it's used to detect stuck workers
+	OldestInFlight() time.Duration
+}
+
+// ReconcileController maps the events of every watched kind to reconcile
+// requests and passes them to its reconciler
+type ReconcileController interface {
+	Watch(obj runtime.Object, mapper handler.RequestMapper, predicates ...predicate.Predicate) error
+	Unwatch(obj runtime.Object) error
+	Start(stop <-chan struct{}) error
+	Done() <-chan struct{}
+	OldestInFlight() time.Duration
 }
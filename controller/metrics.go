@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/metrics"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultRequeue = "requeue"
+)
+
+var reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kubecarve_controller_reconcile_total",
+	Help: "Total number of processed events and requests, partitioned by controller and result",
+}, []string{"controller", "result"})
+
+var handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "kubecarve_controller_handler_duration_seconds",
+	Help:    "Time taken by event handlers and reconcilers, partitioned by controller and event type",
+	Buckets: prometheus.DefBuckets,
+}, []string{"controller", "event"})
+
+var activeWorkers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kubecarve_controller_active_workers",
+	Help: "Number of workers processing an event or request, partitioned by controller",
+}, []string{"controller"})
+
+// the queue of a controller is named after the controller
+var (
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubecarve_workqueue_depth",
+		Help: "Current number of items in the queue, partitioned by controller",
+	}, []string{"controller"})
+	queueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubecarve_workqueue_adds_total",
+		Help: "Total number of items added to the queue, partitioned by controller",
+	}, []string{"controller"})
+	queueLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "kubecarve_workqueue_queue_latency_microseconds",
+		Help: "How long items stay in the queue before being processed, partitioned by controller",
+	}, []string{"controller"})
+	queueWorkDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "kubecarve_workqueue_work_duration_microseconds",
+		Help: "How long processing an item takes, partitioned by controller",
+	}, []string{"controller"})
+	queueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubecarve_workqueue_retries_total",
+		Help: "Total number of rate limited requeues, partitioned by controller",
+	}, []string{"controller"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileTotal)
+	metrics.Registry.MustRegister(handlerDuration)
+	metrics.Registry.MustRegister(activeWorkers)
+	metrics.Registry.MustRegister(queueDepth)
+	metrics.Registry.MustRegister(queueAdds)
+	metrics.Registry.MustRegister(queueLatency)
+	metrics.Registry.MustRegister(queueWorkDuration)
+	metrics.Registry.MustRegister(queueRetries)
+	workqueue.SetProvider(queueMetricsProvider{})
+}
+
+type queueMetricsProvider struct{}
+
+func (queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return queueDepth.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return queueAdds.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return queueLatency.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return queueWorkDuration.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return queueRetries.WithLabelValues(name)
+}
+
+// itemType names the event type of a queued item for metrics
+func itemType(o interface{}) string {
+	switch unwrapItem(o).(type) {
+	case event.CreateEvent:
+		return "create"
+	case event.UpdateEvent:
+		return "update"
+	case event.DeleteEvent:
+		return "delete"
+	case event.GenericEvent:
+		return "generic"
+	case reconcile.Request:
+		return "reconcile"
+	default:
+		return "unknown"
+	}
+}
+
+func observeProcess(controller string, o interface{}, start time.Time, result reconcile.Result, err error) {
+	handlerDuration.WithLabelValues(controller, itemType(o)).Observe(time.Since(start).Seconds())
+	switch {
+	case err != nil:
+		reconcileTotal.WithLabelValues(controller, resultError).Inc()
+	case result.Requeue || result.RequeueAfter > 0:
+		reconcileTotal.WithLabelValues(controller, resultRequeue).Inc()
+	default:
+		reconcileTotal.WithLabelValues(controller, resultSuccess).Inc()
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/metrics"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+// gatherMetric returns the value of the counter or gauge name with labels
+func gatherMetric(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	ut.Assert(t, err == nil, "gather metrics failed:%v", err)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if matchLabels(m, labels) {
+				if m.Counter != nil {
+					return m.Counter.GetValue()
+				}
+				return m.Gauge.GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func matchLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, l := range m.GetLabel() {
+		if v, ok := labels[l.GetName()]; ok {
+			if v != l.GetValue() {
+				return false
+			}
+			matched += 1
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestControllerMetrics(t *testing.T) {
+	//metrics are global, a name of its own keeps the test repeatable
+	name := fmt.Sprintf("metrics-test-%d", time.Now().UnixNano())
+	c := newController(name, nil, nil, Options{MaxRetries: 1})
+	requeued := false
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		switch item {
+		case "error":
+			return reconcile.Result{}, fmt.Errorf("failed")
+		case "requeue":
+			if !requeued {
+				requeued = true
+				return reconcile.Result{Requeue: true}, nil
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+	c.queue.Add("error")
+	c.queue.Add("requeue")
+
+	expected := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"kubecarve_controller_reconcile_total", map[string]string{"controller": name, "result": "error"}, 2},
+		{"kubecarve_controller_reconcile_total", map[string]string{"controller": name, "result": "requeue"}, 1},
+		{"kubecarve_controller_reconcile_total", map[string]string{"controller": name, "result": "success"}, 1},
+		{"kubecarve_controller_active_workers", map[string]string{"controller": name}, 0},
+		{"kubecarve_workqueue_adds_total", map[string]string{"controller": name}, 4},
+		{"kubecarve_workqueue_retries_total", map[string]string{"controller": name}, 2},
+	}
+	//metrics are recorded after process returns
+	wait.PollImmediate(10*time.Millisecond, time.Second, func() (bool, error) {
+		for _, e := range expected {
+			if gatherMetric(t, e.name, e.labels) != e.value {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	for _, e := range expected {
+		ut.Equal(t, gatherMetric(t, e.name, e.labels), e.value)
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RateLimiter decides how long a failed or requeued item waits before it's
+// processed again
+type RateLimiter = workqueue.RateLimiter
+
+// DefaultRateLimiter is the exponential per item backoff from 5ms to 1000s
+// combined with an overall 10 qps, 100 burst token bucket
+func DefaultRateLimiter() RateLimiter {
+	return workqueue.DefaultControllerRateLimiter()
+}
+
+// ExponentialRateLimiter backs off each item separately, the delay doubles
+// from baseDelay on each failure up to maxDelay
+func ExponentialRateLimiter(baseDelay, maxDelay time.Duration) RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay)
+}
+
+// BucketRateLimiter limits the retries of all items together with a token
+// bucket of qps and burst
+func BucketRateLimiter(qps float64, burst int) RateLimiter {
+	return &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)}
+}
+
+// CompositeRateLimiter delays an item by the longest delay of limiters
+func CompositeRateLimiter(limiters ...RateLimiter) RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(limiters...)
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/cloudlinker/kubecarve/cache"
+	"github.com/cloudlinker/kubecarve/handler"
+	"github.com/cloudlinker/kubecarve/predicate"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+// reconcileController queues the requests mapped from the events, so
+// repeated events of one object are merged while waiting in the queue and
+// a retry reconciles the latest state of the object
+type reconcileController struct {
+	*controller
+	reconciler reconcile.Reconciler
+}
+
+func NewReconcileController(name string, cache cache.Cache, scheme *runtime.Scheme, reconciler reconcile.Reconciler, opts Options) ReconcileController {
+	return &reconcileController{
+		controller: newController(name, cache, scheme, opts),
+		reconciler: reconciler,
+	}
+}
+
+func (c *reconcileController) Watch(obj runtime.Object, mapper handler.RequestMapper, predicates ...predicate.Predicate) error {
+	if mapper == nil {
+		return fmt.Errorf("request mapper is required")
+	}
+	return c.addSource(obj, &source{
+		mapper:     mapper,
+		predicates: predicates,
+	})
+}
+
+func (c *reconcileController) Unwatch(obj runtime.Object) error {
+	return c.removeSource(obj)
+}
+
+func (c *reconcileController) Start(stop <-chan struct{}) error {
+	return c.run(stop, c.reconcile)
+}
+
+func (c *reconcileController) reconcile(ctx context.Context, o interface{}) (reconcile.Result, error) {
+	req, ok := o.(reconcile.Request)
+	if !ok {
+		return reconcile.Result{}, handler.TerminalError(fmt.Errorf("unknown request [%v]", reflect.TypeOf(o)))
+	}
+	return c.reconciler.Reconcile(ctx, req)
+}
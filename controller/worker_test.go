@@ -0,0 +1,626 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/handler"
+	"github.com/cloudlinker/kubecarve/predicate"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+func TestConcurrentWorkers(t *testing.T) {
+	c := newController("test", nil, nil, Options{MaxConcurrentReconciles: 4})
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	running := make(map[interface{}]bool)
+	active, maxActive := 0, 0
+	var errs []string
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		defer wg.Done()
+		mu.Lock()
+		if running[item] {
+			errs = append(errs, fmt.Sprintf("%v is processed concurrently", item))
+		}
+		running[item] = true
+		active += 1
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		running[item] = false
+		active -= 1
+		mu.Unlock()
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.run(stop, process)
+		close(done)
+	}()
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		c.queue.Add(fmt.Sprintf("item-%d", i))
+	}
+	wg.Wait()
+
+	//re-adding an item under processing is deferred until it's done
+	wg.Add(1)
+	c.queue.Add("item-0")
+	time.Sleep(10 * time.Millisecond)
+	wg.Add(1)
+	c.queue.Add("item-0")
+	wg.Wait()
+
+	close(stop)
+	<-done
+	ut.Equal(t, len(errs), 0)
+	ut.Equal(t, maxActive, 4)
+}
+
+func TestEventsOfOneObjectInOrder(t *testing.T) {
+	c := newController("test", nil, nil, Options{MaxConcurrentReconciles: 4})
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	running := make(map[string]bool)
+	handled := make(map[string][]string)
+	var errs []string
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		defer wg.Done()
+		var name, op string
+		switch e := item.(watchEvent).event.(type) {
+		case event.CreateEvent:
+			name, op = e.Meta.GetName(), "create"
+		case event.UpdateEvent:
+			name, op = e.MetaNew.GetName(), "update"
+		}
+		mu.Lock()
+		if running[name] {
+			errs = append(errs, fmt.Sprintf("%s is processed concurrently", name))
+		}
+		running[name] = true
+		mu.Unlock()
+
+		//the update is queued while the create is handled
+		if op == "create" {
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		mu.Lock()
+		running[name] = false
+		handled[name] = append(handled[name], op)
+		mu.Unlock()
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.run(stop, process)
+		close(done)
+	}()
+
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	for _, name := range []string{"pod-1", "pod-2"} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		wg.Add(2)
+		c.addEvent(watchEvent{gvk: podGVK, event: event.CreateEvent{Meta: pod, Object: pod}})
+		c.addEvent(watchEvent{gvk: podGVK, event: event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: pod, ObjectNew: pod}})
+	}
+	wg.Wait()
+
+	close(stop)
+	<-done
+	ut.Equal(t, len(errs), 0)
+	ut.Equal(t, handled["pod-1"], []string{"create", "update"})
+	ut.Equal(t, handled["pod-2"], []string{"create", "update"})
+	ut.Equal(t, len(c.pending), 0)
+}
+
+func TestFailedEventRetriedBeforeLaterEvent(t *testing.T) {
+	c := newController("test", nil, nil, Options{MaxConcurrentReconciles: 4})
+
+	var mu sync.Mutex
+	var handled []string
+	updated := make(chan struct{})
+	failed := false
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		op := "update"
+		if _, ok := item.(watchEvent).event.(event.CreateEvent); ok {
+			op = "create"
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, op)
+		if op == "create" && !failed {
+			failed = true
+			return reconcile.Result{}, fmt.Errorf("create failed")
+		}
+		if op == "update" {
+			close(updated)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.run(stop, process)
+		close(done)
+	}()
+
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	c.addEvent(watchEvent{gvk: podGVK, event: event.CreateEvent{Meta: pod, Object: pod}})
+	c.addEvent(watchEvent{gvk: podGVK, event: event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: pod, ObjectNew: pod}})
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("update isn't handled")
+	}
+	close(stop)
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	ut.Equal(t, handled, []string{"create", "create", "update"})
+	ut.Equal(t, len(c.pending), 0)
+}
+
+type fakeEventSource struct {
+	ch   chan interface{}
+	once sync.Once
+	// GetEventChannel waits for ready if it's set, like for an informer
+	// which is syncing
+	ready chan struct{}
+}
+
+func (s *fakeEventSource) GetEventChannel() (<-chan interface{}, error) {
+	if s.ready != nil {
+		<-s.ready
+	}
+	return s.ch, nil
+}
+
+func (s *fakeEventSource) Stop() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+func TestWatchRunningController(t *testing.T) {
+	c := newController("test", nil, nil, Options{})
+	processed := make(chan interface{}, 10)
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		processed <- item
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podSource := &fakeEventSource{ch: make(chan interface{})}
+	err := c.watchSource(podGVK, podSource, &source{})
+	ut.Assert(t, err == nil, "watch on running controller failed:%v", err)
+	err = c.watchSource(podGVK, podSource, &source{})
+	ut.Assert(t, err != nil, "watch same kind twice should fail")
+
+	podSource.ch <- "pod-1"
+	ut.Equal(t, <-processed, watchEvent{gvk: podGVK, event: "pod-1"})
+
+	err = c.unwatchSource(podGVK)
+	ut.Assert(t, err == nil, "unwatch failed:%v", err)
+	err = c.unwatchSource(podGVK)
+	ut.Assert(t, err != nil, "unwatch kind not watched should fail")
+
+	podSource = &fakeEventSource{ch: make(chan interface{})}
+	err = c.watchSource(podGVK, podSource, &source{})
+	ut.Assert(t, err == nil, "watch again after unwatch failed:%v", err)
+	select {
+	case podSource.ch <- "pod-2":
+	case <-time.After(5 * time.Second):
+		t.Fatal("new source isn't collected")
+	}
+	ut.Equal(t, <-processed, watchEvent{gvk: podGVK, event: "pod-2"})
+}
+
+type chanEventHandler struct {
+	name   string
+	events chan string
+}
+
+func (h *chanEventHandler) OnCreate(ctx context.Context, e event.CreateEvent) (handler.Result, error) {
+	h.events <- h.name + " create " + e.Meta.GetName()
+	return handler.Result{}, nil
+}
+
+func (h *chanEventHandler) OnUpdate(ctx context.Context, e event.UpdateEvent) (handler.Result, error) {
+	h.events <- h.name + " update " + e.MetaNew.GetName()
+	return handler.Result{}, nil
+}
+
+func (h *chanEventHandler) OnDelete(ctx context.Context, e event.DeleteEvent) (handler.Result, error) {
+	h.events <- h.name + " delete " + e.Meta.GetName()
+	return handler.Result{}, nil
+}
+
+func (h *chanEventHandler) OnGeneric(ctx context.Context, e event.GenericEvent) (handler.Result, error) {
+	return handler.Result{}, nil
+}
+
+func TestPerWatchHandler(t *testing.T) {
+	c := &eventController{controller: newController("test", nil, nil, Options{})}
+	events := make(chan string, 10)
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podSource := &fakeEventSource{ch: make(chan interface{})}
+	err := c.watchSource(podGVK, podSource, &source{
+		handler:    &chanEventHandler{name: "pod", events: events},
+		predicates: []predicate.Predicate{predicate.NewIgnoreUnchangedUpdate()},
+	})
+	ut.Assert(t, err == nil, "watch pod failed:%v", err)
+	nodeGVK := schema.GroupVersionKind{Version: "v1", Kind: "Node"}
+	nodeSource := &fakeEventSource{ch: make(chan interface{})}
+	err = c.watchSource(nodeGVK, nodeSource, &source{
+		handler: &chanEventHandler{name: "node", events: events},
+	})
+	ut.Assert(t, err == nil, "watch node failed:%v", err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Start(stop)
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", ResourceVersion: "1"}}
+	podSource.ch <- event.CreateEvent{Meta: pod, Object: pod}
+	ut.Equal(t, <-events, "pod create pod-1")
+	//unchanged update is filtered out by the pod predicate
+	podSource.ch <- event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: pod, ObjectNew: pod}
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	nodeSource.ch <- event.DeleteEvent{Meta: node, Object: node}
+	ut.Equal(t, <-events, "node delete node-1")
+}
+
+func TestPanicAndTerminalError(t *testing.T) {
+	c := newController("test", nil, nil, Options{})
+	calls := make(chan string, 10)
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		calls <- item.(string)
+		switch item {
+		case "panic":
+			if c.queue.NumRequeues(item) == 0 {
+				panic("handler bug")
+			}
+		case "terminal":
+			return reconcile.Result{}, handler.TerminalError(fmt.Errorf("invalid spec"))
+		}
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+
+	c.queue.Add("panic")
+	ut.Equal(t, <-calls, "panic")
+	ut.Equal(t, <-calls, "panic")
+
+	c.queue.Add("terminal")
+	ut.Equal(t, <-calls, "terminal")
+	select {
+	case item := <-calls:
+		t.Fatalf("%s shouldn't be retried", item)
+	case <-time.After(100 * time.Millisecond):
+	}
+	ut.Equal(t, c.queue.NumRequeues("terminal"), 0)
+}
+
+func TestEventContext(t *testing.T) {
+	c := newController("test", nil, nil, Options{EventTimeout: 50 * time.Millisecond})
+	errs := make(chan error, 10)
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			errs <- fmt.Errorf("context has no deadline")
+		} else {
+			<-ctx.Done()
+			errs <- ctx.Err()
+		}
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	go c.run(stop, process)
+	c.queue.Add("timeout")
+	ut.Equal(t, <-errs, context.DeadlineExceeded)
+
+	c = newController("test", nil, nil, Options{})
+	process = func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		<-ctx.Done()
+		errs <- ctx.Err()
+		return reconcile.Result{}, nil
+	}
+	stop2 := make(chan struct{})
+	go c.run(stop2, process)
+	c.queue.Add("cancel")
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	close(stop2)
+	ut.Equal(t, <-errs, context.Canceled)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	c := newController("test", nil, nil, Options{GracePeriod: 5 * time.Second})
+	started := make(chan struct{})
+	finished := make(chan error, 1)
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished <- ctx.Err()
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.run(stop, process)
+	}()
+	c.queue.Add("slow")
+	<-started
+	close(stop)
+	ut.Assert(t, <-errCh == nil, "in-flight event should finish in grace period")
+	ut.Assert(t, <-finished == nil, "context shouldn't be cancelled in grace period")
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("done should be closed after shutdown")
+	}
+	ut.Assert(t, c.run(make(chan struct{}), process) != nil, "controller can't be started twice")
+
+	c = newController("test", nil, nil, Options{GracePeriod: 50 * time.Millisecond})
+	started = make(chan struct{})
+	release := make(chan struct{})
+	process = func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		close(started)
+		<-ctx.Done()
+		finished <- ctx.Err()
+		<-release
+		return reconcile.Result{}, nil
+	}
+	stop = make(chan struct{})
+	go func() {
+		errCh <- c.run(stop, process)
+	}()
+	c.queue.Add("stuck")
+	<-started
+	close(stop)
+	ut.Assert(t, <-errCh != nil, "stuck event should exceed grace period")
+	ut.Equal(t, <-finished, context.Canceled)
+	select {
+	case <-c.Done():
+		t.Fatal("done shouldn't be closed before the workers exit")
+	default:
+	}
+	close(release)
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("done should be closed once the workers exit")
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	gaveUp := make(chan interface{}, 1)
+	c := newController("test", nil, nil, Options{
+		RateLimiter: CompositeRateLimiter(ExponentialRateLimiter(time.Millisecond, 10*time.Millisecond), BucketRateLimiter(100, 10)),
+		MaxRetries:  3,
+		OnGiveUp: func(item interface{}, err error) {
+			gaveUp <- item
+		},
+	})
+
+	var mu sync.Mutex
+	calls := 0
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		mu.Lock()
+		calls += 1
+		mu.Unlock()
+		return reconcile.Result{}, fmt.Errorf("cloud api unavailable")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+	c.queue.Add(watchEvent{event: "flaky"})
+	select {
+	case item := <-gaveUp:
+		ut.Equal(t, item, "flaky")
+	case <-time.After(5 * time.Second):
+		t.Fatal("item should be given up")
+	}
+	mu.Lock()
+	ut.Equal(t, calls, 4)
+	mu.Unlock()
+	ut.Equal(t, c.queue.NumRequeues(watchEvent{event: "flaky"}), 0)
+}
+
+func TestMaxRetriesWithBucketRateLimiter(t *testing.T) {
+	//a bucket limiter doesn't count the requeues of items
+	gaveUp := make(chan interface{}, 1)
+	c := newController("test", nil, nil, Options{
+		RateLimiter: BucketRateLimiter(100, 10),
+		MaxRetries:  3,
+		OnGiveUp: func(item interface{}, err error) {
+			gaveUp <- item
+		},
+	})
+
+	var mu sync.Mutex
+	calls := 0
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		mu.Lock()
+		calls += 1
+		mu.Unlock()
+		return reconcile.Result{}, fmt.Errorf("cloud api unavailable")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+	c.queue.Add("flaky")
+	select {
+	case item := <-gaveUp:
+		ut.Equal(t, item, "flaky")
+	case <-time.After(5 * time.Second):
+		t.Fatal("item should be given up")
+	}
+	mu.Lock()
+	ut.Equal(t, calls, 4)
+	mu.Unlock()
+	c.failuresMu.Lock()
+	ut.Equal(t, len(c.failures), 0)
+	c.failuresMu.Unlock()
+}
+
+func TestRequeueNotCountedAsRetry(t *testing.T) {
+	gaveUp := make(chan interface{}, 1)
+	c := newController("test", nil, nil, Options{
+		RateLimiter: ExponentialRateLimiter(time.Millisecond, 10*time.Millisecond),
+		MaxRetries:  2,
+		OnGiveUp: func(item interface{}, err error) {
+			gaveUp <- item
+		},
+	})
+
+	//each requeue asked by a successful call starts the retries over
+	results := []reconcile.Result{{}, {}, {RequeueAfter: time.Millisecond}, {}, {}, {Requeue: true}, {}, {}, {}}
+	done := make(chan struct{})
+	calls := 0
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		result := results[calls]
+		calls += 1
+		if calls == len(results) {
+			close(done)
+			return result, nil
+		}
+		if result.Requeue || result.RequeueAfter > 0 {
+			return result, nil
+		}
+		return result, fmt.Errorf("cloud api unavailable")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+	c.queue.Add("flaky")
+	select {
+	case <-done:
+	case item := <-gaveUp:
+		t.Fatalf("%v shouldn't be given up", item)
+	case <-time.After(5 * time.Second):
+		t.Fatal("item should succeed at last")
+	}
+}
+
+func TestOldestInFlight(t *testing.T) {
+	c := newController("test", nil, nil, Options{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	process := func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		close(started)
+		<-release
+		return reconcile.Result{}, nil
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, process)
+	ut.Equal(t, c.OldestInFlight(), time.Duration(0))
+	c.queue.Add("slow")
+	<-started
+	time.Sleep(20 * time.Millisecond)
+	ut.Assert(t, c.OldestInFlight() >= 20*time.Millisecond, "in-flight item should be reported")
+	close(release)
+}
+
+func TestWatchWaitingForSync(t *testing.T) {
+	c := &eventController{controller: newController("test", nil, nil, Options{})}
+	events := make(chan string, 10)
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podSource := &fakeEventSource{ch: make(chan interface{})}
+	err := c.watchSource(podGVK, podSource, &source{handler: &chanEventHandler{name: "pod", events: events}})
+	ut.Assert(t, err == nil, "watch pod failed:%v", err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Start(stop)
+
+	nodeGVK := schema.GroupVersionKind{Version: "v1", Kind: "Node"}
+	nodeSource := &fakeEventSource{ch: make(chan interface{}), ready: make(chan struct{})}
+	watchErr := make(chan error)
+	go func() {
+		watchErr <- c.watchSource(nodeGVK, nodeSource, &source{handler: &chanEventHandler{name: "node", events: events}})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	err = c.watchSource(nodeGVK, &fakeEventSource{ch: make(chan interface{})}, &source{})
+	ut.Assert(t, err != nil, "kind being watched should be reserved")
+
+	//workers keep processing while the node informer syncs
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1"}}
+	select {
+	case podSource.ch <- event.CreateEvent{Meta: pod, Object: pod}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pod event isn't collected")
+	}
+	select {
+	case e := <-events:
+		ut.Equal(t, e, "pod create pod-1")
+	case <-time.After(5 * time.Second):
+		t.Fatal("pod event isn't processed")
+	}
+	ut.Equal(t, c.OldestInFlight(), time.Duration(0))
+
+	close(nodeSource.ready)
+	ut.Assert(t, <-watchErr == nil, "watch node should succeed once synced")
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	nodeSource.ch <- event.CreateEvent{Meta: node, Object: node}
+	ut.Equal(t, <-events, "node create node-1")
+}
+
+func TestWatchAfterSourceClosed(t *testing.T) {
+	c := newController("test", nil, nil, Options{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.run(stop, func(ctx context.Context, item interface{}) (reconcile.Result, error) {
+		return reconcile.Result{}, nil
+	})
+
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podSource := &fakeEventSource{ch: make(chan interface{})}
+	err := c.watchSource(podGVK, podSource, &source{})
+	ut.Assert(t, err == nil, "watch pod failed:%v", err)
+
+	//the informer is removed from the cache
+	close(podSource.ch)
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return c.watchSource(podGVK, &fakeEventSource{ch: make(chan interface{})}, &source{}) == nil, nil
+	})
+	ut.Assert(t, err == nil, "kind should be watched again after its source is closed")
+}
@@ -1,6 +1,8 @@
 package eventsource
 
 import (
+	"sync"
+
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -12,31 +14,117 @@ import (
 var _ cache.ResourceEventHandler = &HandlerAdaptor{}
 
 type HandlerAdaptor struct {
-	ch chan<- interface{}
+	// informers can't remove their event handlers, a detached adaptor
+	// stays registered and drops every event until it's attached again
+	attachMu sync.Mutex
+	mu       sync.RWMutex
+	ch       chan interface{}
+	stop     <-chan struct{}
+	detached bool
+	detachCh chan struct{}
 }
 
-func newHandlerAdaptor(ch chan<- interface{}) *HandlerAdaptor {
+func newHandlerAdaptor(ch chan interface{}, stop <-chan struct{}) *HandlerAdaptor {
 	return &HandlerAdaptor{
-		ch: ch,
+		ch:       ch,
+		stop:     stop,
+		detachCh: make(chan struct{}),
 	}
 }
 
-func (h *HandlerAdaptor) OnAdd(obj interface{}) {
+// send gives up once stop is closed or the adaptor is detached, so a
+// stopping informer won't wait for a receiver which is gone
+func (h *HandlerAdaptor) send(e interface{}) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.detached {
+		return
+	}
+	h.sendLocked(e)
+}
+
+func (h *HandlerAdaptor) sendLocked(e interface{}) bool {
+	select {
+	case h.ch <- e:
+		return true
+	case <-h.stop:
+		return false
+	case <-h.detachCh:
+		return false
+	}
+}
+
+// detach stops sending events and closes the event channel, it's safe to
+// call more than once
+func (h *HandlerAdaptor) detach() {
+	h.attachMu.Lock()
+	defer h.attachMu.Unlock()
+	if h.detached {
+		return
+	}
+	//unblock the send holding the read lock
+	close(h.detachCh)
+	h.mu.Lock()
+	h.detached = true
+	close(h.ch)
+	h.mu.Unlock()
+}
+
+// attach makes a detached adaptor send events to ch, the objects in store
+// are sent as create events before any other event, like what an informer
+// does for a newly added handler. The returned channel is closed when the
+// adaptor is detached again.
+func (h *HandlerAdaptor) attach(ch chan interface{}, stop <-chan struct{}, store cache.Store) <-chan struct{} {
+	h.attachMu.Lock()
+	defer h.attachMu.Unlock()
+	h.mu.Lock()
+	h.ch = ch
+	h.stop = stop
+	h.detachCh = make(chan struct{})
+	h.detached = false
+	detachCh := h.detachCh
+
+	//the write lock is released after the replay, events from the
+	//informer wait for it
+	go func() {
+		defer h.mu.Unlock()
+		for _, obj := range store.List() {
+			if e, ok := createEvent(obj); ok && !h.sendLocked(e) {
+				return
+			}
+		}
+	}()
+	return detachCh
+}
+
+// detachedCh is closed when the current attachment is detached
+func (h *HandlerAdaptor) detachedCh() <-chan struct{} {
+	h.attachMu.Lock()
+	defer h.attachMu.Unlock()
+	return h.detachCh
+}
+
+func createEvent(obj interface{}) (event.CreateEvent, bool) {
 	c := event.CreateEvent{}
 
 	if o, err := meta.Accessor(obj); err == nil {
 		c.Meta = o
 	} else {
-		return
+		return c, false
 	}
 
 	if o, ok := obj.(runtime.Object); ok {
 		c.Object = o
 	} else {
-		return
+		return c, false
 	}
+	return c, true
+}
 
-	h.ch <- c
+func (h *HandlerAdaptor) OnAdd(obj interface{}) {
+	if c, ok := createEvent(obj); ok {
+		h.send(c)
+	}
 }
 
 func (h *HandlerAdaptor) OnUpdate(oldObj, newObj interface{}) {
@@ -66,7 +154,7 @@ func (h *HandlerAdaptor) OnUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	h.ch <- u
+	h.send(u)
 }
 
 func (h *HandlerAdaptor) OnDelete(obj interface{}) {
@@ -100,5 +188,5 @@ func (h *HandlerAdaptor) OnDelete(obj interface{}) {
 		return
 	}
 
-	h.ch <- d
+	h.send(d)
 }
@@ -2,8 +2,10 @@ package eventsource
 
 import (
 	"fmt"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
 
 	"github.com/cloudlinker/kubecarve/cache"
 )
@@ -12,9 +14,15 @@ const (
 	defaultBufferSize = 1024
 )
 
+// resourceEventSource registers one adaptor with the informer of its kind,
+// after Stop, the adaptor is attached again by GetEventChannel instead of
+// registering a new one, so watching a kind again doesn't leak handlers
 type resourceEventSource struct {
-	gvk   schema.GroupVersionKind
-	cache cache.Cache
+	gvk      schema.GroupVersionKind
+	cache    cache.Cache
+	mu       sync.Mutex
+	informer toolscache.SharedIndexInformer
+	adaptor  *HandlerAdaptor
 }
 
 var _ EventSource = &resourceEventSource{}
@@ -26,6 +34,13 @@ func New(gvk schema.GroupVersionKind, cache cache.Cache) EventSource {
 	}
 }
 
+// stoppableInformer is implemented by informers which can be removed from
+// the cache individually
+type stoppableInformer interface {
+	Stopping() <-chan struct{}
+	Done() <-chan struct{}
+}
+
 func (l *resourceEventSource) GetEventChannel() (<-chan interface{}, error) {
 	i, err := l.cache.GetInformerForKind(l.gvk)
 	if err != nil {
@@ -33,10 +48,46 @@ func (l *resourceEventSource) GetEventChannel() (<-chan interface{}, error) {
 	}
 
 	ch := make(chan interface{})
-	i.AddEventHandler(newHandlerAdaptor(ch))
+	var stopping, done <-chan struct{}
+	if si, ok := i.(stoppableInformer); ok {
+		stopping, done = si.Stopping(), si.Done()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var detached <-chan struct{}
+	if l.adaptor != nil && l.informer == i {
+		l.adaptor.detach()
+		detached = l.adaptor.attach(ch, stopping, i.GetStore())
+	} else {
+		//the adaptor of a removed informer goes away with it
+		l.informer = i
+		l.adaptor = newHandlerAdaptor(ch, stopping)
+		detached = l.adaptor.detachedCh()
+		i.AddEventHandler(l.adaptor)
+	}
+	if done != nil {
+		adaptor := l.adaptor
+		go func() {
+			select {
+			case <-done:
+				adaptor.detach()
+			case <-detached:
+			}
+		}()
+	}
 	return ch, nil
 }
 
+func (l *resourceEventSource) Stop() {
+	l.mu.Lock()
+	adaptor := l.adaptor
+	l.mu.Unlock()
+	if adaptor != nil {
+		adaptor.detach()
+	}
+}
+
 func (l *resourceEventSource) String() string {
 	return fmt.Sprintf("kind source: %v", l.gvk.String())
 }
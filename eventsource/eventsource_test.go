@@ -0,0 +1,97 @@
+package eventsource
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/cache"
+	"github.com/cloudlinker/kubecarve/event"
+)
+
+// countingInformer counts the handlers added to it
+type countingInformer struct {
+	toolscache.SharedIndexInformer
+	mu       sync.Mutex
+	handlers int
+}
+
+func (i *countingInformer) AddEventHandler(h toolscache.ResourceEventHandler) {
+	i.mu.Lock()
+	i.handlers += 1
+	i.mu.Unlock()
+	i.SharedIndexInformer.AddEventHandler(h)
+}
+
+func (i *countingInformer) handlerCount() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.handlers
+}
+
+type fakeCache struct {
+	cache.Cache
+	informer toolscache.SharedIndexInformer
+}
+
+func (c *fakeCache) GetInformerForKind(gvk schema.GroupVersionKind) (toolscache.SharedIndexInformer, error) {
+	return c.informer, nil
+}
+
+func receive(t *testing.T, ch <-chan interface{}) interface{} {
+	select {
+	case e, ok := <-ch:
+		ut.Assert(t, ok, "event channel shouldn't be closed")
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event is received")
+	}
+	return nil
+}
+
+func TestWatchAgainReusesHandler(t *testing.T) {
+	watcher := watch.NewFake()
+	lw := &toolscache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{
+				Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}},
+			}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watcher, nil
+		},
+	}
+	informer := &countingInformer{
+		SharedIndexInformer: toolscache.NewSharedIndexInformer(lw, &corev1.Pod{}, 0, toolscache.Indexers{}),
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go informer.Run(stop)
+	ut.Assert(t, toolscache.WaitForCacheSync(stop, informer.HasSynced), "informer should sync")
+
+	es := New(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, &fakeCache{informer: informer})
+	for i := 0; i < 3; i++ {
+		ch, err := es.GetEventChannel()
+		ut.Assert(t, err == nil, "get event channel failed:%v", err)
+		//the objects in the informer are replayed to every watch
+		e := receive(t, ch)
+		ut.Equal(t, e.(event.CreateEvent).Meta.GetName(), "pod-1")
+
+		watcher.Modify(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default", ResourceVersion: "2"}})
+		e = receive(t, ch)
+		ut.Equal(t, e.(event.UpdateEvent).MetaNew.GetResourceVersion(), "2")
+
+		es.Stop()
+		_, ok := <-ch
+		ut.Assert(t, !ok, "event channel should be closed on stop")
+	}
+	ut.Equal(t, informer.handlerCount(), 1)
+}
@@ -2,4 +2,7 @@ package eventsource
 
 type EventSource interface {
 	GetEventChannel() (<-chan interface{}, error)
+	// Stop detaches the source from the informer and closes the event
+	// channel got before, GetEventChannel may be called again after Stop
+	Stop()
 }
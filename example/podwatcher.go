@@ -3,14 +3,13 @@ package main
 import (
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes/scheme"
 	"log"
 
-	"github.com/cloudlinker/kubecarve/cache"
 	"github.com/cloudlinker/kubecarve/client/config"
 	"github.com/cloudlinker/kubecarve/controller"
 	"github.com/cloudlinker/kubecarve/event"
 	"github.com/cloudlinker/kubecarve/handler"
+	"github.com/cloudlinker/kubecarve/manager"
 	"github.com/cloudlinker/kubecarve/predicate"
 )
 
@@ -48,19 +47,22 @@ func main() {
 		log.Panic(fmt.Sprintf("get config failed:%v\n", err))
 	}
 
-	stop := make(chan struct{})
-	defer close(stop)
-
-	c, err := cache.New(cfg, cache.Options{})
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: ":8080"})
 	if err != nil {
-		log.Panic(fmt.Sprintf("create cache failed %v\n", err))
+		log.Panic(fmt.Sprintf("create manager failed %v\n", err))
 	}
-	go c.Start(stop)
 
-	c.WaitForCacheSync(stop)
+	ctrl := controller.New("dumbController", mgr.GetCache(), mgr.GetScheme(), controller.Options{})
+	if err := ctrl.Watch(&corev1.Pod{}, handler.AdaptEventHandler(&dumbEventHandler{}), predicate.NewIgnoreUnchangedUpdate()); err != nil {
+		log.Panic(fmt.Sprintf("watch pod failed %v\n", err))
+	}
+	if err := mgr.Add(ctrl); err != nil {
+		log.Panic(fmt.Sprintf("add controller failed %v\n", err))
+	}
 
-	ctrl := controller.New("dumbController", c, scheme.Scheme)
-	ctrl.Watch(&corev1.Pod{})
-	handler := &dumbEventHandler{}
-	ctrl.Start(stop, handler, predicate.NewIgnoreUnchangedUpdate())
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := mgr.Start(stop); err != nil {
+		log.Printf("manager stopped with error %v\n", err)
+	}
 }
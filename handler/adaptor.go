@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/cloudlinker/kubecarve/event"
+)
+
+var _ ContextEventHandler = &eventHandlerAdaptor{}
+
+type eventHandlerAdaptor struct {
+	handler EventHandler
+}
+
+// AdaptEventHandler turns h to a ContextEventHandler which ignores the
+// context
+func AdaptEventHandler(h EventHandler) ContextEventHandler {
+	return &eventHandlerAdaptor{handler: h}
+}
+
+func (a *eventHandlerAdaptor) OnCreate(_ context.Context, e event.CreateEvent) (Result, error) {
+	return a.handler.OnCreate(e)
+}
+
+func (a *eventHandlerAdaptor) OnUpdate(_ context.Context, e event.UpdateEvent) (Result, error) {
+	return a.handler.OnUpdate(e)
+}
+
+func (a *eventHandlerAdaptor) OnDelete(_ context.Context, e event.DeleteEvent) (Result, error) {
+	return a.handler.OnDelete(e)
+}
+
+func (a *eventHandlerAdaptor) OnGeneric(_ context.Context, e event.GenericEvent) (Result, error) {
+	return a.handler.OnGeneric(e)
+}
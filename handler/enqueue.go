@@ -0,0 +1,54 @@
+package handler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+var _ RequestMapper = &EnqueueRequestForObject{}
+
+// EnqueueRequestForObject maps an event to the request of the object in it
+type EnqueueRequestForObject struct{}
+
+func (e *EnqueueRequestForObject) MapCreate(evt event.CreateEvent) []reconcile.Request {
+	return requestsForMeta(evt.Meta)
+}
+
+func (e *EnqueueRequestForObject) MapUpdate(evt event.UpdateEvent) []reconcile.Request {
+	return requestsForMeta(evt.MetaOld, evt.MetaNew)
+}
+
+func (e *EnqueueRequestForObject) MapDelete(evt event.DeleteEvent) []reconcile.Request {
+	return requestsForMeta(evt.Meta)
+}
+
+func (e *EnqueueRequestForObject) MapGeneric(evt event.GenericEvent) []reconcile.Request {
+	return requestsForMeta(evt.Meta)
+}
+
+// requestsForMeta skips nil metas and duplicated keys
+func requestsForMeta(metas ...metav1.Object) []reconcile.Request {
+	var reqs []reconcile.Request
+	for _, m := range metas {
+		if m == nil {
+			continue
+		}
+		reqs = appendRequest(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: m.GetNamespace(),
+			Name:      m.GetName(),
+		}})
+	}
+	return reqs
+}
+
+func appendRequest(reqs []reconcile.Request, req reconcile.Request) []reconcile.Request {
+	for _, r := range reqs {
+		if r == req {
+			return reqs
+		}
+	}
+	return append(reqs, req)
+}
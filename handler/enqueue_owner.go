@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/cloudlinker/kubecarve/client/apiutil"
+	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+var _ RequestMapper = &enqueueRequestForOwner{}
+
+// enqueueRequestForOwner maps an event to the requests of the owners of the
+// object whose kind is ownerGK
+type enqueueRequestForOwner struct {
+	ownerGK      schema.GroupKind
+	isController bool
+	// clusterScoped owners are mapped to requests without namespace
+	clusterScoped bool
+}
+
+// EnqueueRequestForOwner returns a mapper which maps the events of child
+// objects to their owners of ownerType kind, found in the ownerReferences.
+// If isController is true, only the owner which is the managing controller
+// is mapped. mapper tells the scope of ownerType, namespaced owners are in
+// the namespace of the child.
+func EnqueueRequestForOwner(scheme *runtime.Scheme, mapper meta.RESTMapper, ownerType runtime.Object, isController bool) (RequestMapper, error) {
+	gvk, err := apiutil.GVKForObject(ownerType, scheme)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &enqueueRequestForOwner{
+		ownerGK:       gvk.GroupKind(),
+		isController:  isController,
+		clusterScoped: mapping.Scope.Name() == meta.RESTScopeNameRoot,
+	}, nil
+}
+
+func (e *enqueueRequestForOwner) MapCreate(evt event.CreateEvent) []reconcile.Request {
+	return e.requestsForOwners(nil, evt.Meta)
+}
+
+// the owners before and after the update are both mapped, so the old owner
+// knows it loses the child
+func (e *enqueueRequestForOwner) MapUpdate(evt event.UpdateEvent) []reconcile.Request {
+	return e.requestsForOwners(e.requestsForOwners(nil, evt.MetaOld), evt.MetaNew)
+}
+
+func (e *enqueueRequestForOwner) MapDelete(evt event.DeleteEvent) []reconcile.Request {
+	return e.requestsForOwners(nil, evt.Meta)
+}
+
+func (e *enqueueRequestForOwner) MapGeneric(evt event.GenericEvent) []reconcile.Request {
+	return e.requestsForOwners(nil, evt.Meta)
+}
+
+func (e *enqueueRequestForOwner) requestsForOwners(reqs []reconcile.Request, m metav1.Object) []reconcile.Request {
+	if m == nil {
+		return reqs
+	}
+
+	for _, ref := range m.GetOwnerReferences() {
+		if e.isController && (ref.Controller == nil || !*ref.Controller) {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			continue
+		}
+		if gv.Group != e.ownerGK.Group || ref.Kind != e.ownerGK.Kind {
+			continue
+		}
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: ref.Name}}
+		if !e.clusterScoped {
+			req.Namespace = m.GetNamespace()
+		}
+		reqs = appendRequest(reqs, req)
+	}
+	return reqs
+}
+
+// MapFunc maps an object to the requests of the objects to reconcile
+type MapFunc func(runtime.Object) []reconcile.Request
+
+var _ RequestMapper = &enqueueRequestsFromMapFunc{}
+
+type enqueueRequestsFromMapFunc struct {
+	fn MapFunc
+}
+
+// EnqueueRequestsFromMapFunc returns a mapper which maps the object in an
+// event with fn, for updates both the old and new objects are mapped
+func EnqueueRequestsFromMapFunc(fn MapFunc) RequestMapper {
+	return &enqueueRequestsFromMapFunc{fn: fn}
+}
+
+func (e *enqueueRequestsFromMapFunc) MapCreate(evt event.CreateEvent) []reconcile.Request {
+	return e.mapObjects(evt.Object)
+}
+
+func (e *enqueueRequestsFromMapFunc) MapUpdate(evt event.UpdateEvent) []reconcile.Request {
+	return e.mapObjects(evt.ObjectOld, evt.ObjectNew)
+}
+
+func (e *enqueueRequestsFromMapFunc) MapDelete(evt event.DeleteEvent) []reconcile.Request {
+	return e.mapObjects(evt.Object)
+}
+
+func (e *enqueueRequestsFromMapFunc) MapGeneric(evt event.GenericEvent) []reconcile.Request {
+	return e.mapObjects(evt.Object)
+}
+
+func (e *enqueueRequestsFromMapFunc) mapObjects(objs ...runtime.Object) []reconcile.Request {
+	var reqs []reconcile.Request
+	for _, obj := range objs {
+		if obj == nil {
+			continue
+		}
+		for _, req := range e.fn(obj) {
+			reqs = appendRequest(reqs, req)
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+func newRequest(namespace, name string) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+func newRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Node"), meta.RESTScopeRoot)
+	return mapper
+}
+
+func TestEnqueueRequestForOwner(t *testing.T) {
+	restMapper := newRESTMapper()
+	isController := true
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "pod-1",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs-1", Controller: &isController},
+			{APIVersion: "apps/v1beta2", Kind: "ReplicaSet", Name: "rs-2"},
+			{APIVersion: "v1", Kind: "ReplicaSet", Name: "rs-3"},
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "deploy-1"},
+		},
+	}}
+
+	mapper, err := EnqueueRequestForOwner(scheme.Scheme, restMapper, &appsv1.ReplicaSet{}, false)
+	ut.Assert(t, err == nil, "create mapper failed:%v", err)
+	ut.Equal(t, mapper.MapCreate(event.CreateEvent{Meta: pod, Object: pod}),
+		[]reconcile.Request{newRequest("default", "rs-1"), newRequest("default", "rs-2")})
+
+	mapper, err = EnqueueRequestForOwner(scheme.Scheme, restMapper, &appsv1.ReplicaSet{}, true)
+	ut.Assert(t, err == nil, "create mapper failed:%v", err)
+	ut.Equal(t, mapper.MapDelete(event.DeleteEvent{Meta: pod, Object: pod}),
+		[]reconcile.Request{newRequest("default", "rs-1")})
+
+	newPod := pod.DeepCopy()
+	newPod.OwnerReferences[0].Name = "rs-4"
+	ut.Equal(t, mapper.MapUpdate(event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: newPod, ObjectNew: newPod}),
+		[]reconcile.Request{newRequest("default", "rs-1"), newRequest("default", "rs-4")})
+
+	_, err = EnqueueRequestForOwner(runtime.NewScheme(), restMapper, &appsv1.ReplicaSet{}, true)
+	ut.Assert(t, err != nil, "owner type unknown to scheme should fail")
+	_, err = EnqueueRequestForOwner(scheme.Scheme, restMapper, &appsv1.Deployment{}, true)
+	ut.Assert(t, err != nil, "owner type unknown to rest mapper should fail")
+}
+
+func TestEnqueueRequestForClusterScopedOwner(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "pod-1",
+		Namespace: "kube-system",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "v1", Kind: "Node", Name: "node-1"},
+		},
+	}}
+
+	mapper, err := EnqueueRequestForOwner(scheme.Scheme, newRESTMapper(), &corev1.Node{}, false)
+	ut.Assert(t, err == nil, "create mapper failed:%v", err)
+	ut.Equal(t, mapper.MapCreate(event.CreateEvent{Meta: pod, Object: pod}),
+		[]reconcile.Request{newRequest("", "node-1")})
+}
+
+func TestEnqueueRequestsFromMapFunc(t *testing.T) {
+	mapper := EnqueueRequestsFromMapFunc(func(obj runtime.Object) []reconcile.Request {
+		pod := obj.(*corev1.Pod)
+		return []reconcile.Request{newRequest(pod.Namespace, pod.Spec.NodeName)}
+	})
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}, Spec: corev1.PodSpec{NodeName: "node-1"}}
+	ut.Equal(t, mapper.MapGeneric(event.GenericEvent{Meta: pod, Object: pod}), []reconcile.Request{newRequest("default", "node-1")})
+
+	newPod := pod.DeepCopy()
+	ut.Equal(t, mapper.MapUpdate(event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: newPod, ObjectNew: newPod}),
+		[]reconcile.Request{newRequest("default", "node-1")})
+	newPod.Spec.NodeName = "node-2"
+	ut.Equal(t, mapper.MapUpdate(event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: newPod, ObjectNew: newPod}),
+		[]reconcile.Request{newRequest("default", "node-1"), newRequest("default", "node-2")})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/reconcile"
+)
+
+func TestEnqueueRequestForObject(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "pod-1"}}
+	mapper := &EnqueueRequestForObject{}
+
+	ut.Equal(t, mapper.MapCreate(event.CreateEvent{Meta: pod, Object: pod}), []reconcile.Request{req})
+	ut.Equal(t, mapper.MapDelete(event.DeleteEvent{Meta: pod, Object: pod}), []reconcile.Request{req})
+	ut.Equal(t, mapper.MapGeneric(event.GenericEvent{Meta: pod, Object: pod}), []reconcile.Request{req})
+
+	newPod := pod.DeepCopy()
+	newPod.Labels = map[string]string{"app": "nginx"}
+	ut.Equal(t, mapper.MapUpdate(event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: newPod, ObjectNew: newPod}), []reconcile.Request{req})
+
+	ut.Equal(t, len(mapper.MapCreate(event.CreateEvent{})), 0)
+}
+
+func TestTerminalError(t *testing.T) {
+	err := fmt.Errorf("invalid spec")
+	ut.Assert(t, TerminalError(nil) == nil, "nil error shouldn't be wrapped")
+	ut.Assert(t, IsTerminalError(TerminalError(err)), "wrapped error should be terminal")
+	ut.Assert(t, !IsTerminalError(err), "plain error isn't terminal")
+	ut.Equal(t, TerminalErrorCause(TerminalError(err)), err)
+	ut.Equal(t, TerminalError(err).Error(), "invalid spec")
+}
@@ -0,0 +1,33 @@
+package handler
+
+// terminalError wraps an error which retrying won't fix
+type terminalError struct {
+	err error
+}
+
+func (e *terminalError) Error() string {
+	return e.err.Error()
+}
+
+// TerminalError marks err as terminal, the controller logs it and doesn't
+// requeue the event or request, while other errors are requeued with
+// backoff
+func TerminalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &terminalError{err: err}
+}
+
+func IsTerminalError(err error) bool {
+	_, ok := err.(*terminalError)
+	return ok
+}
+
+// TerminalErrorCause returns the error marked as terminal
+func TerminalErrorCause(err error) error {
+	if e, ok := err.(*terminalError); ok {
+		return e.err
+	}
+	return err
+}
@@ -1,15 +1,13 @@
 package handler
 
 import (
-	"time"
+	"context"
 
 	"github.com/cloudlinker/kubecarve/event"
+	"github.com/cloudlinker/kubecarve/reconcile"
 )
 
-type Result struct {
-	Requeue      bool
-	RequeueAfter time.Duration
-}
+type Result = reconcile.Result
 
 type EventHandler interface {
 	OnCreate(event.CreateEvent) (Result, error)
@@ -17,3 +15,21 @@ type EventHandler interface {
 	OnDelete(event.DeleteEvent) (Result, error)
 	OnGeneric(event.GenericEvent) (Result, error)
 }
+
+// ContextEventHandler is EventHandler with a context, which is cancelled
+// when the controller stops or the event times out
+type ContextEventHandler interface {
+	OnCreate(context.Context, event.CreateEvent) (Result, error)
+	OnUpdate(context.Context, event.UpdateEvent) (Result, error)
+	OnDelete(context.Context, event.DeleteEvent) (Result, error)
+	OnGeneric(context.Context, event.GenericEvent) (Result, error)
+}
+
+// RequestMapper maps an event to the requests of the objects to reconcile,
+// it's used by reconcile controllers in place of EventHandler
+type RequestMapper interface {
+	MapCreate(event.CreateEvent) []reconcile.Request
+	MapUpdate(event.UpdateEvent) []reconcile.Request
+	MapDelete(event.DeleteEvent) []reconcile.Request
+	MapGeneric(event.GenericEvent) []reconcile.Request
+}
@@ -0,0 +1,63 @@
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudlinker/kubecarve/cache"
+)
+
+// InformerStatuser reports the state of informers, it's implemented by
+// cache.Cache
+type InformerStatuser interface {
+	InformerStatuses() []cache.InformerStatus
+}
+
+// CacheSynced fails while any informer of the cache isn't synced, the
+// informers pending on their CRD are ignored
+func CacheSynced(c InformerStatuser) Checker {
+	return func(*http.Request) error {
+		var unsynced []string
+		for _, status := range c.InformerStatuses() {
+			if !status.Pending && !status.Synced {
+				unsynced = append(unsynced, status.GVK.String())
+			}
+		}
+		if len(unsynced) > 0 {
+			return fmt.Errorf("informers not synced: %s", strings.Join(unsynced, ", "))
+		}
+		return nil
+	}
+}
+
+// LeaderElected fails until elected is closed, add it to readiness only if
+// non-leaders shouldn't be ready
+func LeaderElected(elected <-chan struct{}) Checker {
+	return func(*http.Request) error {
+		select {
+		case <-elected:
+			return nil
+		default:
+			return fmt.Errorf("not leader")
+		}
+	}
+}
+
+// InFlightReporter tells how long the longest running handler call has
+// been running, it's implemented by controllers
+type InFlightReporter interface {
+	OldestInFlight() time.Duration
+}
+
+// WorkersNotStuck fails if a handler call of the controller has been running
+// longer than threshold, add it to liveness to restart stuck processes
+func WorkersNotStuck(c InFlightReporter, threshold time.Duration) Checker {
+	return func(*http.Request) error {
+		if d := c.OldestInFlight(); d > threshold {
+			return fmt.Errorf("a worker has been running for %v", d.Round(time.Second))
+		}
+		return nil
+	}
+}
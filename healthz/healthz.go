@@ -0,0 +1,107 @@
+package healthz
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Checker returns an error if the check fails
+type Checker func(req *http.Request) error
+
+// Ping always passes, it tells the process is serving
+func Ping(*http.Request) error {
+	return nil
+}
+
+// Handler runs its named checks on each request. The request of the
+// handler path runs every check, and path/<name> runs the check name only.
+// The response lists the result of each check, the status code is 500 if
+// any check fails.
+type Handler struct {
+	mu     sync.RWMutex
+	checks map[string]Checker
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		checks: make(map[string]Checker),
+	}
+}
+
+func (h *Handler) AddCheck(name string, check Checker) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid check name %q", name)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; ok {
+		return fmt.Errorf("check %s is added more than once", name)
+	}
+	h.checks[name] = check
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	names, checks := h.selectChecks(req)
+	if len(names) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+
+	var buf bytes.Buffer
+	failed := false
+	for i, name := range names {
+		if err := checks[i](req); err != nil {
+			failed = true
+			fmt.Fprintf(&buf, "[-]%s failed: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&buf, "[+]%s ok\n", name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+		buf.WriteString("check failed\n")
+	} else {
+		buf.WriteString("check passed\n")
+	}
+	w.Write(buf.Bytes())
+}
+
+// selectChecks returns the checks to run sorted by name, the handler is
+// mounted with its path stripped, so a non-empty path names the check
+func (h *Handler) selectChecks(req *http.Request) ([]string, []Checker) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	name := strings.Trim(req.URL.Path, "/")
+	if name != "" {
+		check, ok := h.checks[name]
+		if !ok {
+			return nil, nil
+		}
+		return []string{name}, []Checker{check}
+	}
+
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Checker, 0, len(names))
+	for _, name := range names {
+		checks = append(checks, h.checks[name])
+	}
+	//a handler without checks passes
+	if len(names) == 0 {
+		return []string{"ping"}, []Checker{Ping}
+	}
+	return names, checks
+}
@@ -0,0 +1,71 @@
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/cache"
+)
+
+func serve(h http.Handler, path string) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler()
+	code, _ := serve(h, "/")
+	ut.Equal(t, code, http.StatusOK)
+
+	ut.Assert(t, h.AddCheck("ping", Ping) == nil, "add check should succeed")
+	ut.Assert(t, h.AddCheck("ping", Ping) != nil, "add check twice should fail")
+	ut.Assert(t, h.AddCheck("a/b", Ping) != nil, "check name with slash should fail")
+	ut.Assert(t, h.AddCheck("broken", func(*http.Request) error {
+		return fmt.Errorf("disk full")
+	}) == nil, "add check should succeed")
+
+	code, body := serve(h, "/")
+	ut.Equal(t, code, http.StatusInternalServerError)
+	ut.Assert(t, strings.Contains(body, "[+]ping ok"), "ping should pass: %s", body)
+	ut.Assert(t, strings.Contains(body, "[-]broken failed: disk full"), "broken should fail: %s", body)
+
+	code, _ = serve(h, "/ping")
+	ut.Equal(t, code, http.StatusOK)
+	code, _ = serve(h, "/unknown")
+	ut.Equal(t, code, http.StatusNotFound)
+}
+
+type fakeStatuser []cache.InformerStatus
+
+func (s fakeStatuser) InformerStatuses() []cache.InformerStatus {
+	return s
+}
+
+type fakeInFlight time.Duration
+
+func (f fakeInFlight) OldestInFlight() time.Duration {
+	return time.Duration(f)
+}
+
+func TestCheckers(t *testing.T) {
+	pod := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	crd := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Foo"}
+	ut.Assert(t, CacheSynced(fakeStatuser{{GVK: pod, Synced: true}, {GVK: crd, Pending: true}})(nil) == nil, "synced cache should pass")
+	ut.Assert(t, CacheSynced(fakeStatuser{{GVK: pod}})(nil) != nil, "unsynced cache should fail")
+
+	elected := make(chan struct{})
+	ut.Assert(t, LeaderElected(elected)(nil) != nil, "non-leader should fail")
+	close(elected)
+	ut.Assert(t, LeaderElected(elected)(nil) == nil, "leader should pass")
+
+	ut.Assert(t, WorkersNotStuck(fakeInFlight(time.Second), time.Minute)(nil) == nil, "busy worker should pass")
+	ut.Assert(t, WorkersNotStuck(fakeInFlight(time.Hour), time.Minute)(nil) != nil, "stuck worker should fail")
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/cloudlinker/kubecarve/cache"
+	"github.com/cloudlinker/kubecarve/client"
+	"github.com/cloudlinker/kubecarve/healthz"
+)
+
+// Runnable is run by the manager until stop is closed, controllers are
+// Runnables. With leader election, a Runnable only runs on the leader
+// unless it implements LeaderElectionRunnable and doesn't need it.
+type Runnable interface {
+	Start(stop <-chan struct{}) error
+}
+
+// RunnableFunc is a Runnable implemented by a function
+type RunnableFunc func(stop <-chan struct{}) error
+
+func (f RunnableFunc) Start(stop <-chan struct{}) error {
+	return f(stop)
+}
+
+// Manager shares one cache, client and event publisher among the
+// runnables it runs
+type Manager interface {
+	// Add runs r along with the other runnables, r is started right away
+	// if the manager is running
+	Add(r Runnable) error
+	// Start starts the cache, waits for it to sync, then starts the
+	// runnables. It blocks until stop is closed or a runnable fails, then
+	// stops the runnables before the cache and returns the first error.
+	Start(stop <-chan struct{}) error
+
+	GetConfig() *rest.Config
+	GetScheme() *runtime.Scheme
+	GetCache() cache.Cache
+	// GetClient reads from the cache and writes to the API server
+	GetClient() client.Client
+	GetEventRecorderFor(name string) record.EventRecorder
+	// Elected is closed once the manager becomes leader, or once it
+	// starts the runnables if leader election is disabled
+	Elected() <-chan struct{}
+
+	// AddHealthzCheck and AddReadyzCheck add named checks to /healthz and
+	// /readyz of the probe server
+	AddHealthzCheck(name string, check healthz.Checker) error
+	AddReadyzCheck(name string, check healthz.Checker) error
+}
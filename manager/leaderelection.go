@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+const inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+var (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElectionRunnable is implemented by runnables which tell whether
+// they need leader election, runnables not implementing it only run on the
+// leader
+type LeaderElectionRunnable interface {
+	NeedLeaderElection() bool
+}
+
+func needLeaderElection(r Runnable) bool {
+	if ler, ok := r.(LeaderElectionRunnable); ok {
+		return ler.NeedLeaderElection()
+	}
+	return true
+}
+
+type LeaderElectionOptions struct {
+	// ID is the name of the lock object
+	ID string
+	// Namespace of the lock object, defaults to the namespace of the pod
+	// when running in cluster
+	Namespace string
+	// ResourceLock is the kind of the lock object, resourcelock.ConfigMapsResourceLock
+	// by default or resourcelock.EndpointsResourceLock. Leases aren't
+	// supported by the client-go version in use.
+	ResourceLock string
+	// LeaseDuration, RenewDeadline and RetryPeriod default to 15s, 10s and 2s.
+	// The leader releases the lease when the manager stops, so another
+	// candidate takes over without waiting for it to expire. The election
+	// goroutine of a stopped manager returns after at most RetryPeriod
+	// plus RenewDeadline.
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+func newResourceLock(config *rest.Config, recorder func(string) record.EventRecorder, opts LeaderElectionOptions) (resourcelock.Interface, error) {
+	if opts.ID == "" {
+		return nil, fmt.Errorf("leader election id is required")
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		data, err := ioutil.ReadFile(inClusterNamespacePath)
+		if err != nil {
+			return nil, fmt.Errorf("leader election namespace isn't set and can't be read in cluster: %v", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	lockType := opts.ResourceLock
+	if lockType == "" {
+		lockType = resourcelock.ConfigMapsResourceLock
+	}
+
+	id, err := newIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init clientSet: %v", err)
+	}
+
+	return resourcelock.New(lockType, namespace, opts.ID, clientSet.CoreV1(), resourcelock.ResourceLockConfig{
+		Identity:      id,
+		EventRecorder: recorder(id),
+	})
+}
+
+// newIdentity makes the identity of the candidate unique even if two
+// replicas share a hostname
+func newIdentity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hostname + "_" + hex.EncodeToString(b), nil
+}
+
+func newLeaderElector(lock resourcelock.Interface, opts LeaderElectionOptions, callbacks leaderelection.LeaderCallbacks) (*leaderelection.LeaderElector, error) {
+	leaseDuration, renewDeadline, retryPeriod := opts.LeaseDuration, opts.RenewDeadline, opts.RetryPeriod
+	if leaseDuration == 0 {
+		leaseDuration = defaultLeaseDuration
+	}
+	if renewDeadline == 0 {
+		renewDeadline = defaultRenewDeadline
+	}
+	if retryPeriod == 0 {
+		retryPeriod = defaultRetryPeriod
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Callbacks:     callbacks,
+	})
+}
+
+var errLockReleased = errors.NewServiceUnavailable("leader election is stopped")
+
+// stoppableLock works around the leader elector of the client-go version in
+// use, which can't be stopped. Once stopped, the lease held by the candidate
+// is released, and the lock turns local: one create succeeds so a candidate
+// still acquiring returns, every other operation fails so the elector loses
+// the lease after RenewDeadline and returns. A released lease is reported
+// as held by the candidate, which makes the elector take it without waiting
+// for it to expire. Candidates racing for a released lease are kept apart
+// by the lock itself: the configmap and endpoints locks update the object
+// got last, so only the first update passes the resourceVersion check.
+type stoppableLock struct {
+	resourcelock.Interface
+	mu      sync.Mutex
+	stopped bool
+	// exited is set once the create letting the elector return succeeded
+	exited bool
+	// takeover is set when the last record got is a released lease
+	takeover bool
+}
+
+func (l *stoppableLock) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return
+	}
+	l.stopped = true
+
+	record, err := l.Interface.Get()
+	if err != nil || record.HolderIdentity != l.Identity() {
+		return
+	}
+	now := metav1.Now()
+	if err := l.Interface.Update(resourcelock.LeaderElectionRecord{
+		LeaseDurationSeconds: 1,
+		AcquireTime:          now,
+		RenewTime:            now,
+		LeaderTransitions:    record.LeaderTransitions,
+	}); err != nil {
+		log.Printf("release lease %s failed: %v\n", l.Describe(), err)
+	}
+}
+
+func (l *stoppableLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return nil, errors.NewNotFound(schema.GroupResource{}, l.Describe())
+	}
+
+	record, err := l.Interface.Get()
+	if err != nil {
+		return nil, err
+	}
+	l.takeover = record.HolderIdentity == ""
+	if l.takeover {
+		record.HolderIdentity = l.Identity()
+	}
+	return record, nil
+}
+
+func (l *stoppableLock) Create(ler resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		if l.exited {
+			return errLockReleased
+		}
+		l.exited = true
+		return nil
+	}
+	return l.Interface.Create(ler)
+}
+
+func (l *stoppableLock) Update(ler resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return errLockReleased
+	}
+	if l.takeover {
+		//the elector keeps the acquire time and transitions of a lease it
+		//holds, a released lease changes hands
+		ler.AcquireTime = ler.RenewTime
+		ler.LeaderTransitions++
+	}
+	return l.Interface.Update(ler)
+}
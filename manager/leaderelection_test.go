@@ -0,0 +1,251 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	ut "github.com/cloudlinker/cement/unittest"
+)
+
+// memoryLock keeps the record in a store shared by the candidates, like
+// the configmap lock an update fails if the record changed since the
+// candidate got or created it
+type memoryLock struct {
+	store    *lockStore
+	identity string
+	version  int
+}
+
+type lockStore struct {
+	mu      sync.Mutex
+	record  *resourcelock.LeaderElectionRecord
+	version int
+}
+
+func (l *memoryLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.record == nil {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "test-lock")
+	}
+	record := *l.store.record
+	l.version = l.store.version
+	return &record, nil
+}
+
+func (l *memoryLock) Create(ler resourcelock.LeaderElectionRecord) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.record != nil {
+		return errors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "test-lock")
+	}
+	l.store.record = &ler
+	l.store.version++
+	l.version = l.store.version
+	return nil
+}
+
+func (l *memoryLock) Update(ler resourcelock.LeaderElectionRecord) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.record == nil {
+		return errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "test-lock")
+	}
+	if l.version != l.store.version {
+		return errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "test-lock", fmt.Errorf("the object has been modified"))
+	}
+	l.store.record = &ler
+	l.store.version++
+	l.version = l.store.version
+	return nil
+}
+
+func (l *memoryLock) RecordEvent(string) {}
+
+func (l *memoryLock) Identity() string {
+	return l.identity
+}
+
+func (l *memoryLock) Describe() string {
+	return "test-lock"
+}
+
+type leaderRunnable struct {
+	needLeaderElection bool
+	started            chan struct{}
+}
+
+func (r *leaderRunnable) Start(stop <-chan struct{}) error {
+	close(r.started)
+	<-stop
+	return nil
+}
+
+func (r *leaderRunnable) NeedLeaderElection() bool {
+	return r.needLeaderElection
+}
+
+func isClosed(ch <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	store := &lockStore{}
+	//the lease outlives the test, a new leader is only elected in time if
+	//the lease is released
+	opts := LeaderElectionOptions{
+		LeaseDuration: time.Minute,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+
+	newCandidate := func(identity string) (*manager, *leaderRunnable, *leaderRunnable) {
+		m := newManager(nil, nil, &fakeCache{steps: &steps{}}, nil, nil)
+		err := m.setLeaderElection(&memoryLock{store: store, identity: identity}, opts)
+		ut.Assert(t, err == nil, "set leader election failed:%v", err)
+		leader := &leaderRunnable{needLeaderElection: true, started: make(chan struct{})}
+		warmup := &leaderRunnable{needLeaderElection: false, started: make(chan struct{})}
+		m.Add(leader)
+		m.Add(warmup)
+		return m, leader, warmup
+	}
+
+	m1, leader1, warmup1 := newCandidate("candidate-1")
+	stop1 := make(chan struct{})
+	errCh1 := make(chan error, 1)
+	go func() {
+		errCh1 <- m1.Start(stop1)
+	}()
+	ut.Assert(t, isClosed(m1.Elected(), 5*time.Second), "first candidate should be elected")
+	ut.Assert(t, isClosed(leader1.started, time.Second), "leader runnable should run on leader")
+	ut.Assert(t, isClosed(warmup1.started, time.Second), "warm-up runnable should run")
+
+	m2, leader2, warmup2 := newCandidate("candidate-2")
+	stop2 := make(chan struct{})
+	defer close(stop2)
+	go m2.Start(stop2)
+	ut.Assert(t, isClosed(warmup2.started, time.Second), "warm-up runnable should run on non-leader")
+	ut.Assert(t, !isClosed(leader2.started, 500*time.Millisecond), "leader runnable shouldn't run on non-leader")
+
+	close(stop1)
+	ut.Assert(t, <-errCh1 == nil, "manager should stop without error")
+	ut.Assert(t, isClosed(m2.Elected(), 5*time.Second), "second candidate should take over the released lease")
+	ut.Assert(t, isClosed(leader2.started, time.Second), "leader runnable should run on new leader")
+	ut.Assert(t, isClosed(m1.electorDone, 5*time.Second), "elector of stopped leader should return")
+
+	record, err := (&memoryLock{store: store}).Get()
+	ut.Assert(t, err == nil, "get lock record failed:%v", err)
+	ut.Equal(t, record.HolderIdentity, "candidate-2")
+	ut.Equal(t, record.LeaderTransitions, 1)
+
+	m3, _, warmup3 := newCandidate("candidate-3")
+	stop3 := make(chan struct{})
+	errCh3 := make(chan error, 1)
+	go func() {
+		errCh3 <- m3.Start(stop3)
+	}()
+	ut.Assert(t, isClosed(warmup3.started, time.Second), "warm-up runnable should run on non-leader")
+	close(stop3)
+	ut.Assert(t, <-errCh3 == nil, "manager should stop without error")
+	ut.Assert(t, isClosed(m3.electorDone, 5*time.Second), "elector of stopped non-leader should return")
+	ut.Assert(t, !isClosed(m3.Elected(), 0), "stopped non-leader shouldn't be elected")
+
+	record, err = (&memoryLock{store: store}).Get()
+	ut.Assert(t, err == nil, "get lock record failed:%v", err)
+	ut.Equal(t, record.HolderIdentity, "candidate-2")
+}
+
+// releasedStore holds a lease released by a stopped leader
+func releasedStore() *lockStore {
+	now := metav1.Now()
+	return &lockStore{
+		record: &resourcelock.LeaderElectionRecord{
+			LeaseDurationSeconds: 1,
+			AcquireTime:          now,
+			RenewTime:            now,
+			LeaderTransitions:    1,
+		},
+		version: 1,
+	}
+}
+
+func TestTakeOverReleasedLeaseOnce(t *testing.T) {
+	store := releasedStore()
+	lock1 := &stoppableLock{Interface: &memoryLock{store: store, identity: "candidate-1"}}
+	lock2 := &stoppableLock{Interface: &memoryLock{store: store, identity: "candidate-2"}}
+
+	record1, err := lock1.Get()
+	ut.Assert(t, err == nil, "get lock record failed:%v", err)
+	ut.Equal(t, record1.HolderIdentity, "candidate-1")
+	record2, err := lock2.Get()
+	ut.Assert(t, err == nil, "get lock record failed:%v", err)
+	ut.Equal(t, record2.HolderIdentity, "candidate-2")
+
+	now := metav1.Now()
+	err = lock1.Update(resourcelock.LeaderElectionRecord{HolderIdentity: "candidate-1", RenewTime: now, LeaderTransitions: record1.LeaderTransitions})
+	ut.Assert(t, err == nil, "first update should take the lease:%v", err)
+	err = lock2.Update(resourcelock.LeaderElectionRecord{HolderIdentity: "candidate-2", RenewTime: now, LeaderTransitions: record2.LeaderTransitions})
+	ut.Assert(t, errors.IsConflict(err), "second update should conflict but get %v", err)
+
+	record, err := lock2.Get()
+	ut.Assert(t, err == nil, "get lock record failed:%v", err)
+	ut.Equal(t, record.HolderIdentity, "candidate-1")
+	ut.Equal(t, record.LeaderTransitions, 2)
+}
+
+func TestCandidatesCompeteForReleasedLease(t *testing.T) {
+	store := releasedStore()
+	opts := LeaderElectionOptions{
+		LeaseDuration: time.Minute,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+
+	var managers []*manager
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, identity := range []string{"candidate-1", "candidate-2"} {
+		m := newManager(nil, nil, &fakeCache{steps: &steps{}}, nil, nil)
+		err := m.setLeaderElection(&memoryLock{store: store, identity: identity}, opts)
+		ut.Assert(t, err == nil, "set leader election failed:%v", err)
+		managers = append(managers, m)
+	}
+	for _, m := range managers {
+		go m.Start(stop)
+	}
+
+	select {
+	case <-managers[0].Elected():
+	case <-managers[1].Elected():
+	case <-time.After(5 * time.Second):
+		t.Fatal("one candidate should take the released lease")
+	}
+	//the loser renews its view of the lease, it mustn't be elected before
+	//the lease expires
+	time.Sleep(time.Second)
+	elected := 0
+	for _, m := range managers {
+		select {
+		case <-m.Elected():
+			elected += 1
+		default:
+		}
+	}
+	ut.Equal(t, elected, 1)
+
+	record, err := (&memoryLock{store: store}).Get()
+	ut.Assert(t, err == nil, "get lock record failed:%v", err)
+	ut.Equal(t, record.LeaderTransitions, 2)
+}
@@ -0,0 +1,343 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/cloudlinker/kubecarve/cache"
+	"github.com/cloudlinker/kubecarve/client"
+	"github.com/cloudlinker/kubecarve/client/apiutil"
+	"github.com/cloudlinker/kubecarve/healthz"
+	"github.com/cloudlinker/kubecarve/metrics"
+	"github.com/cloudlinker/kubecarve/publisher"
+	"github.com/cloudlinker/kubecarve/util"
+)
+
+type Options struct {
+	Scheme *runtime.Scheme
+	Mapper meta.RESTMapper
+	// Cache is used to create the shared cache, its Scheme and Mapper are
+	// replaced with the ones of the manager
+	Cache cache.Options
+	// LeaderElection makes the runnables which need leader election start
+	// only after the lock is acquired, and the manager stops with an error
+	// once the lock is lost. Nil disables leader election.
+	LeaderElection *LeaderElectionOptions
+	// HealthProbeBindAddress is where /healthz and /readyz are served, the
+	// probe server is disabled if it's empty. Readiness checks the cache
+	// sync by default.
+	HealthProbeBindAddress string
+	// MetricsBindAddress is where metrics.Registry is served on /metrics,
+	// the metrics server is disabled if it's empty or "0", so managers in
+	// one process don't fight over a default port
+	MetricsBindAddress string
+	// EnablePprof serves the pprof profiles on /debug/pprof/ of the
+	// metrics server
+	EnablePprof bool
+}
+
+type manager struct {
+	config    *rest.Config
+	scheme    *runtime.Scheme
+	cache     cache.Cache
+	client    client.Client
+	publisher publisher.EventPublisher
+
+	// lock and elector are nil if leader election is disabled
+	lock    *stoppableLock
+	elector *leaderelection.LeaderElector
+	// electorDone is closed once the elector returns
+	electorDone chan struct{}
+	elected     chan struct{}
+
+	probeAddr   string
+	metricsAddr string
+	enablePprof bool
+	healthz     *healthz.Handler
+	readyz      *healthz.Handler
+
+	mu        sync.Mutex
+	runnables []Runnable
+	// leaderRunnables are started once the manager becomes leader
+	leaderRunnables []Runnable
+	started         bool
+	running         bool
+	leading         bool
+	stopped         bool
+	// runStop is closed to stop the runnables, the cache is stopped after
+	// they all returned
+	runStop chan struct{}
+	wg      sync.WaitGroup
+	errCh   chan error
+}
+
+func New(config *rest.Config, opts Options) (Manager, error) {
+	util.Assert(config != nil, "nil rest config is provided")
+
+	if opts.Scheme == nil {
+		opts.Scheme = scheme.Scheme
+	}
+	if opts.Mapper == nil {
+		mapper, err := apiutil.NewDiscoveryRESTMapper(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not create RESTMapper from config: %v", err)
+		}
+		opts.Mapper = mapper
+	}
+
+	cacheOpts := opts.Cache
+	cacheOpts.Scheme = opts.Scheme
+	cacheOpts.Mapper = opts.Mapper
+	c, err := cache.New(config, cacheOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	liveClient, err := client.New(config, client.Options{Scheme: opts.Scheme, Mapper: opts.Mapper})
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := publisher.New(config, opts.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newManager(config, opts.Scheme, c, client.NewDelegatingClient(c, liveClient), p)
+	m.probeAddr = opts.HealthProbeBindAddress
+	m.metricsAddr = opts.MetricsBindAddress
+	m.enablePprof = opts.EnablePprof
+	if err := m.readyz.AddCheck("cache", healthz.CacheSynced(c)); err != nil {
+		return nil, err
+	}
+	if opts.LeaderElection != nil {
+		lock, err := newResourceLock(config, p.GetEventRecorderFor, *opts.LeaderElection)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.setLeaderElection(lock, *opts.LeaderElection); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func newManager(config *rest.Config, scheme *runtime.Scheme, c cache.Cache, cli client.Client, p publisher.EventPublisher) *manager {
+	return &manager{
+		config:    config,
+		scheme:    scheme,
+		cache:     c,
+		client:    cli,
+		publisher: p,
+		elected:   make(chan struct{}),
+		healthz:   healthz.NewHandler(),
+		readyz:    healthz.NewHandler(),
+		runStop:   make(chan struct{}),
+		errCh:     make(chan error, 1),
+	}
+}
+
+func (m *manager) setLeaderElection(lock resourcelock.Interface, opts LeaderElectionOptions) error {
+	m.lock = &stoppableLock{Interface: lock}
+	elector, err := newLeaderElector(m.lock, opts, leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(<-chan struct{}) {
+			m.startLeading()
+		},
+		OnStoppedLeading: func() {
+			m.reportError(fmt.Errorf("leader election lost"))
+		},
+	})
+	if err != nil {
+		return err
+	}
+	m.elector = elector
+	m.electorDone = make(chan struct{})
+	return nil
+}
+
+func (m *manager) GetConfig() *rest.Config {
+	return m.config
+}
+
+func (m *manager) GetScheme() *runtime.Scheme {
+	return m.scheme
+}
+
+func (m *manager) GetCache() cache.Cache {
+	return m.cache
+}
+
+func (m *manager) GetClient() client.Client {
+	return m.client
+}
+
+func (m *manager) GetEventRecorderFor(name string) record.EventRecorder {
+	return m.publisher.GetEventRecorderFor(name)
+}
+
+func (m *manager) AddHealthzCheck(name string, check healthz.Checker) error {
+	return m.healthz.AddCheck(name, check)
+}
+
+func (m *manager) AddReadyzCheck(name string, check healthz.Checker) error {
+	return m.readyz.AddCheck(name, check)
+}
+
+func (m *manager) probeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", http.StripPrefix("/healthz", m.healthz))
+	mux.Handle("/healthz/", http.StripPrefix("/healthz", m.healthz))
+	mux.Handle("/readyz", http.StripPrefix("/readyz", m.readyz))
+	mux.Handle("/readyz/", http.StripPrefix("/readyz", m.readyz))
+	return mux
+}
+
+func (m *manager) Elected() <-chan struct{} {
+	return m.elected
+}
+
+func (m *manager) Add(r Runnable) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return fmt.Errorf("manager is stopped")
+	}
+
+	if needLeaderElection(r) {
+		m.leaderRunnables = append(m.leaderRunnables, r)
+		if m.leading {
+			m.startRunnable(r)
+		}
+	} else {
+		m.runnables = append(m.runnables, r)
+		if m.running {
+			m.startRunnable(r)
+		}
+	}
+	return nil
+}
+
+func (m *manager) startLeading() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped || m.leading {
+		return
+	}
+
+	m.leading = true
+	close(m.elected)
+	for _, r := range m.leaderRunnables {
+		m.startRunnable(r)
+	}
+}
+
+func (m *manager) reportError(err error) {
+	//only the first error is reported
+	select {
+	case m.errCh <- err:
+	default:
+	}
+}
+
+// startRunnable should be called with lock held
+func (m *manager) startRunnable(r Runnable) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if err := r.Start(m.runStop); err != nil {
+			m.reportError(err)
+		}
+	}()
+}
+
+func (m *manager) Start(stop <-chan struct{}) error {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		return fmt.Errorf("manager is already started")
+	}
+	m.started = true
+	m.mu.Unlock()
+
+	//the probe server outlives everything else, so liveness holds during
+	//cache sync and shutdown
+	if m.probeAddr != "" {
+		probe, err := listen("probe", m.probeAddr, m.probeHandler())
+		if err != nil {
+			return err
+		}
+		probe.serve(m)
+		defer probe.shutdown()
+	}
+	if m.metricsAddr != "" && m.metricsAddr != "0" {
+		ms, err := listen("metrics", m.metricsAddr, metrics.Handler(m.enablePprof))
+		if err != nil {
+			return err
+		}
+		ms.serve(m)
+		defer ms.shutdown()
+	}
+
+	cacheStop := make(chan struct{})
+	cacheErr := make(chan error, 1)
+	go func() {
+		cacheErr <- m.cache.Start(cacheStop)
+	}()
+
+	var err error
+	if m.cache.WaitForCacheSync(stop) {
+		m.mu.Lock()
+		m.running = true
+		for _, r := range m.runnables {
+			m.startRunnable(r)
+		}
+		m.mu.Unlock()
+
+		if m.elector == nil {
+			m.startLeading()
+		} else {
+			go func() {
+				defer close(m.electorDone)
+				m.elector.Run()
+			}()
+		}
+
+		select {
+		case <-stop:
+		case err = <-m.errCh:
+		}
+	}
+
+	m.mu.Lock()
+	m.running = false
+	m.leading = false
+	m.stopped = true
+	close(m.runStop)
+	m.mu.Unlock()
+	m.wg.Wait()
+	if m.lock != nil {
+		m.lock.stop()
+	}
+
+	if err == nil {
+		select {
+		case err = <-m.errCh:
+		default:
+		}
+	}
+
+	close(cacheStop)
+	if cerr := <-cacheErr; err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	ut "github.com/cloudlinker/cement/unittest"
+	"github.com/cloudlinker/kubecarve/cache"
+	"github.com/cloudlinker/kubecarve/healthz"
+)
+
+// fakeCache records the order it's started and stopped in
+type fakeCache struct {
+	cache.Cache
+	steps *steps
+}
+
+func (c *fakeCache) Start(stop <-chan struct{}) error {
+	c.steps.add("cache started")
+	<-stop
+	c.steps.add("cache stopped")
+	return nil
+}
+
+func (c *fakeCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	return true
+}
+
+type steps struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (s *steps) add(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, step)
+}
+
+func (s *steps) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.steps...)
+}
+
+func waitRunnable(s *steps, name string, started chan<- struct{}) Runnable {
+	return RunnableFunc(func(stop <-chan struct{}) error {
+		started <- struct{}{}
+		<-stop
+		time.Sleep(10 * time.Millisecond)
+		s.add(name + " stopped")
+		return nil
+	})
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	s := &steps{}
+	m := newManager(nil, nil, &fakeCache{steps: s}, nil, nil)
+	started := make(chan struct{}, 2)
+	ut.Assert(t, m.Add(waitRunnable(s, "runnable-1", started)) == nil, "add runnable should succeed")
+
+	stop := make(chan struct{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- m.Start(stop)
+	}()
+	<-started
+	//added after start
+	ut.Assert(t, m.Add(waitRunnable(s, "runnable-2", started)) == nil, "add runnable should succeed")
+	<-started
+
+	close(stop)
+	ut.Assert(t, <-errCh == nil, "manager should stop without error")
+	steps := s.get()
+	ut.Equal(t, len(steps), 4)
+	ut.Equal(t, steps[0], "cache started")
+	ut.Equal(t, steps[3], "cache stopped")
+	ut.Assert(t, m.Add(waitRunnable(s, "runnable-3", started)) != nil, "add to stopped manager should fail")
+	ut.Assert(t, m.Start(make(chan struct{})) != nil, "manager can't be started twice")
+}
+
+func TestManagerRunnableError(t *testing.T) {
+	s := &steps{}
+	m := newManager(nil, nil, &fakeCache{steps: s}, nil, nil)
+	started := make(chan struct{}, 1)
+	m.Add(waitRunnable(s, "runnable-1", started))
+	m.Add(RunnableFunc(func(stop <-chan struct{}) error {
+		return fmt.Errorf("leader election lost")
+	}))
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- m.Start(make(chan struct{}))
+	}()
+	select {
+	case err := <-errCh:
+		ut.Assert(t, err != nil && err.Error() == "leader election lost", "runnable error should be returned but get %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("manager should stop on runnable error")
+	}
+	ut.Equal(t, s.get(), []string{"cache started", "runnable-1 stopped", "cache stopped"})
+}
+
+func TestProbeHandler(t *testing.T) {
+	m := newManager(nil, nil, &fakeCache{steps: &steps{}}, nil, nil)
+	m.AddReadyzCheck("leader", healthz.LeaderElected(m.Elected()))
+	handler := m.probeHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	ut.Equal(t, w.Code, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz/leader", nil))
+	ut.Equal(t, w.Code, http.StatusInternalServerError)
+
+	m.startLeading()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	ut.Equal(t, w.Code, http.StatusOK)
+}
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const serverShutdownTimeout = 5 * time.Second
+
+// server serves handler on addr, the listener is created before the
+// manager starts anything so a bad address fails Start right away
+type server struct {
+	name     string
+	listener net.Listener
+	srv      *http.Server
+}
+
+func listen(name, addr string, handler http.Handler) (*server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &server{
+		name:     name,
+		listener: ln,
+		srv:      &http.Server{Handler: handler},
+	}, nil
+}
+
+func (s *server) serve(m *manager) {
+	go func() {
+		if err := s.srv.Serve(s.listener); err != nil && err != http.ErrServerClosed {
+			m.reportError(fmt.Errorf("%s server failed: %v", s.name, err))
+		}
+	}()
+}
+
+func (s *server) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+// the request url isn't a label, object names in the path would make the
+// series unbounded
+var requestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "kubecarve_rest_client_request_latency_seconds",
+	Help:    "Request latency of the REST clients talking to the API server, partitioned by verb",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 10),
+}, []string{"verb"})
+
+var requestResult = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kubecarve_rest_client_requests_total",
+	Help: "Number of requests sent to the API server, partitioned by status code, method and host",
+}, []string{"code", "method", "host"})
+
+func init() {
+	Registry.MustRegister(requestLatency)
+	Registry.MustRegister(requestResult)
+	clientmetrics.Register(latencyAdapter{}, resultAdapter{})
+}
+
+type latencyAdapter struct{}
+
+func (latencyAdapter) Observe(verb string, u url.URL, latency time.Duration) {
+	requestLatency.WithLabelValues(verb).Observe(latency.Seconds())
+}
+
+type resultAdapter struct{}
+
+func (resultAdapter) Increment(code, method, host string) {
+	requestResult.WithLabelValues(code, method, host).Inc()
+}
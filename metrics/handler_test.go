@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+
+	ut "github.com/cloudlinker/cement/unittest"
+)
+
+func get(h http.Handler, path string) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code, w.Body.String()
+}
+
+func requestCount(t *testing.T, code, method, host string) float64 {
+	var m dto.Metric
+	err := requestResult.WithLabelValues(code, method, host).Write(&m)
+	ut.Assert(t, err == nil, "read request count failed:%v", err)
+	return m.Counter.GetValue()
+}
+
+func TestHandler(t *testing.T) {
+	//the adapters of client-go are global, only the increment is checked
+	count := requestCount(t, "200", "GET", "10.0.0.1:6443")
+	clientmetrics.RequestResult.Increment("200", "GET", "10.0.0.1:6443")
+	ut.Equal(t, requestCount(t, "200", "GET", "10.0.0.1:6443"), count+1)
+	clientmetrics.RequestLatency.Observe("GET", *httptest.NewRequest("GET", "/api/v1/pods", nil).URL, time.Millisecond)
+
+	code, body := get(Handler(false), "/metrics")
+	ut.Equal(t, code, http.StatusOK)
+	ut.Assert(t, strings.Contains(body, `kubecarve_rest_client_requests_total{code="200",host="10.0.0.1:6443",method="GET"}`), "client-go result should be exported: %s", body)
+	ut.Assert(t, strings.Contains(body, "kubecarve_rest_client_request_latency_seconds_count"), "client-go latency should be exported")
+
+	code, _ = get(Handler(false), "/debug/pprof/")
+	ut.Equal(t, code, http.StatusNotFound)
+	code, _ = get(Handler(true), "/debug/pprof/")
+	ut.Equal(t, code, http.StatusOK)
+}
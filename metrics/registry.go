@@ -0,0 +1,10 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registry is the prometheus registry shared by the client, cache and
+// controller metrics of kubecarve, register custom metrics with it to have
+// them exposed together
+var Registry = prometheus.NewRegistry()
@@ -0,0 +1,34 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Request identifies the object to reconcile, the reconciler reads its
+// current state from the cache instead of getting it from an event
+type Request struct {
+	types.NamespacedName
+}
+
+// Result tells the controller whether and when to process the request again
+type Result struct {
+	Requeue      bool
+	RequeueAfter time.Duration
+}
+
+// Reconciler drives the object identified by the request to its desired
+// state. Requests of the same object are merged while they wait in the
+// queue, and a request is never reconciled concurrently with itself.
+type Reconciler interface {
+	Reconcile(ctx context.Context, req Request) (Result, error)
+}
+
+// Func is a Reconciler implemented by a function
+type Func func(context.Context, Request) (Result, error)
+
+func (f Func) Reconcile(ctx context.Context, req Request) (Result, error) {
+	return f(ctx, req)
+}